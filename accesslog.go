@@ -0,0 +1,220 @@
+package lambada
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Field is a key-value pair of a structured log record.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// A FieldLogger logs structured records. It can easily be implemented on top of structured logging libraries, such as
+// zap, zerolog or log/slog.
+type FieldLogger interface {
+	Log(msg string, fields ...Field)
+}
+
+// FieldLoggerFunc is an adapter allowing to use a function as a FieldLogger.
+type FieldLoggerFunc func(msg string, fields ...Field)
+
+// Log calls f(msg, fields...).
+func (f FieldLoggerFunc) Log(msg string, fields ...Field) {
+	f(msg, fields...)
+}
+
+// AccessLogFormat is the format of the records written by the FieldLogger returned by NewAccessLogWriter.
+type AccessLogFormat int
+
+const (
+	// AccessLogJSON writes every record as a JSON object, including the message in the msg key.
+	AccessLogJSON AccessLogFormat = iota
+
+	// AccessLogCombined writes access records using the Apache combined log format. Fields which are not part of the
+	// format are not written.
+	AccessLogCombined
+)
+
+// accessLogMessage is the message of the access records.
+const accessLogMessage = "access"
+
+// combinedTimeFormat is the time format used by the combined log format.
+const combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// WithAccessLog enables access logging: one record is logged to logger per invocation, with the "access" message and
+// the following fields, in order:
+//   - time: the time the invocation started (time.Time)
+//   - method, path, protocol: the request method, path and protocol
+//   - route: the route template (e.g. /items/{id}), if any
+//   - status: the response status code, or 500 if the http.Handler panicked
+//   - size: the size of the response body, in bytes
+//   - durationMs: the duration of the invocation, in milliseconds (float64)
+//   - requestId: the request id (see WithRequestID), or the API Gateway request id
+//   - lambdaRequestId: the Lambda request id
+//   - sourceIp, userAgent, referer: the client information
+//   - coldStart: true if the invocation is the first one handled by the handler
+//   - error: the error returned by the handler (or "http.Handler panicked"), only if any
+//
+// Use NewAccessLogWriter to write JSON or combined format records to an io.Writer.
+func WithAccessLog(logger FieldLogger) Option {
+	return func(o *options) {
+		o.accessLogger = logger
+	}
+}
+
+// accessLog holds the state of the access logging of a handler.
+type accessLog struct {
+	logger FieldLogger
+	mu     sync.Mutex
+	warm   bool
+}
+
+// log logs the access record of an invocation.
+func (a *accessLog) log(ctx context.Context, start time.Time, req *Request, res *Response, size int, err error) {
+	a.mu.Lock()
+	coldStart := !a.warm
+	a.warm = true
+	a.mu.Unlock()
+
+	requestID := RequestIDFromContext(ctx)
+	if requestID == "" {
+		requestID = req.RequestContext.RequestID
+	}
+
+	method, path, protocol, sourceIP := req.HTTPMethod, req.Path, req.RequestContext.Protocol,
+		req.RequestContext.Identity.SourceIP
+	if req.Version == "2.0" {
+		method, path, protocol, sourceIP = req.RequestContext.HTTP.Method, req.RawPath, req.RequestContext.HTTP.Protocol,
+			req.RequestContext.HTTP.SourceIP
+	}
+	if sourceIP == "" {
+		// ALB events only provide the X-Forwarded-For header
+		sourceIP, _, _ = strings.Cut(req.header("x-forwarded-for"), ",")
+		sourceIP = strings.TrimSpace(sourceIP)
+	}
+
+	fields := []Field{
+		{"time", start},
+		{"method", method},
+		{"path", path},
+		{"protocol", protocol},
+		{"route", routeTemplate(req)},
+		{"status", res.StatusCode},
+		{"size", size},
+		{"durationMs", float64(time.Since(start)) / float64(time.Millisecond)},
+		{"requestId", requestID},
+		{"lambdaRequestId", LambdaRequestIDFromContext(ctx)},
+		{"sourceIp", sourceIP},
+		{"userAgent", req.header("user-agent")},
+		{"referer", req.header("referer")},
+		{"coldStart", coldStart},
+	}
+	if err != nil {
+		fields = append(fields, Field{"error", err.Error()})
+	}
+	a.logger.Log(accessLogMessage, fields...)
+}
+
+// routeTemplate returns the route template of req (e.g. /items/{id}), or an empty string if unknown.
+func routeTemplate(req *Request) string {
+	if req.Version != "2.0" {
+		return req.Resource
+	}
+	if _, route, ok := strings.Cut(req.RouteKey, " "); ok {
+		return route
+	}
+	return req.RouteKey
+}
+
+// NewAccessLogWriter returns a FieldLogger writing one line per record to w, using the given format.
+// The returned FieldLogger is safe for concurrent use.
+func NewAccessLogWriter(w io.Writer, format AccessLogFormat) FieldLogger {
+	return &accessLogWriter{w: w, format: format}
+}
+
+type accessLogWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format AccessLogFormat
+}
+
+func (l *accessLogWriter) Log(msg string, fields ...Field) {
+	var line []byte
+	if l.format == AccessLogCombined {
+		line = formatCombined(fields)
+	} else {
+		line = formatJSON(msg, fields)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(line)
+}
+
+// formatJSON formats a record as a JSON object, preserving the order of the fields.
+func formatJSON(msg string, fields []Field) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"msg":`)
+	writeJSONValue(&buf, msg)
+	for _, f := range fields {
+		buf.WriteByte(',')
+		writeJSONValue(&buf, f.Key)
+		buf.WriteByte(':')
+		writeJSONValue(&buf, f.Value)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+func writeJSONValue(buf *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("<failed to marshal json: %v>", err))
+	}
+	buf.Write(data)
+}
+
+// formatCombined formats a record using the Apache combined log format.
+func formatCombined(fields []Field) []byte {
+	values := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		values[f.Key] = f.Value
+	}
+	str := func(key string) string {
+		if v := values[key]; v != nil {
+			if s := fmt.Sprint(v); s != "" {
+				return s
+			}
+		}
+		return "-"
+	}
+	quoted := func(key string) string {
+		s := str(key)
+		if s == "-" {
+			return `"-"`
+		}
+		return strconv.Quote(s)
+	}
+
+	t, _ := values["time"].(time.Time)
+	size := str("size")
+	if size == "0" {
+		size = "-"
+	}
+	request := str("method") + " " + str("path")
+	if protocol := str("protocol"); protocol != "-" {
+		request += " " + protocol
+	}
+
+	return []byte(fmt.Sprintf("%s - - [%s] %s %s %s %s %s\n", str("sourceIp"), t.Format(combinedTimeFormat),
+		strconv.Quote(request), str("status"), size, quoted("referer"), quoted("userAgent")))
+}
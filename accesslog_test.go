@@ -0,0 +1,163 @@
+package lambada
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLog(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var records [][]Field
+	logger := FieldLoggerFunc(func(msg string, fields ...Field) {
+		assert.Equal("access", msg)
+		records = append(records, fields)
+	})
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("Hello"))
+	}), WithAccessLog(logger))
+
+	req := Request{
+		Version:  "2.0",
+		RouteKey: "POST /items/{id}",
+		RawPath:  "/items/1",
+		Headers:  map[string]string{"user-agent": "test/1.0", "referer": "https://example.com/"},
+	}
+	req.RequestContext.RequestID = "apigw-id"
+	req.RequestContext.HTTP.Method = http.MethodPost
+	req.RequestContext.HTTP.Protocol = "HTTP/1.1"
+	req.RequestContext.HTTP.SourceIP = "10.0.0.1"
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "lambda-id"})
+
+	_, err := h(ctx, req)
+	require.NoError(err)
+	_, err = h(ctx, req)
+	require.NoError(err)
+	require.Len(records, 2)
+
+	values := map[string]interface{}{}
+	for _, f := range records[0] {
+		values[f.Key] = f.Value
+	}
+	assert.IsType(time.Time{}, values["time"])
+	assert.IsType(float64(0), values["durationMs"])
+	assert.Equal(http.MethodPost, values["method"])
+	assert.Equal("/items/1", values["path"])
+	assert.Equal("HTTP/1.1", values["protocol"])
+	assert.Equal("/items/{id}", values["route"])
+	assert.Equal(http.StatusCreated, values["status"])
+	assert.Equal(5, values["size"])
+	assert.Equal("apigw-id", values["requestId"])
+	assert.Equal("lambda-id", values["lambdaRequestId"])
+	assert.Equal("10.0.0.1", values["sourceIp"])
+	assert.Equal("test/1.0", values["userAgent"])
+	assert.Equal("https://example.com/", values["referer"])
+	assert.Equal(true, values["coldStart"])
+	assert.NotContains(values, "error")
+
+	assert.Equal(Field{"coldStart", false}, records[1][len(records[1])-1])
+}
+
+func TestAccessLogError(t *testing.T) {
+	assert := assert.New(t)
+
+	var fields []Field
+	h := NewHandler(http.NotFoundHandler(), WithAccessLog(FieldLoggerFunc(func(msg string, f ...Field) {
+		fields = f
+	})))
+	_, err := h(context.Background(), Request{
+		Resource:        "/{proxy+}",
+		HTTPMethod:      http.MethodGet,
+		Path:            "/a",
+		Headers:         map[string]string{"X-Forwarded-For": "10.0.0.2, 10.0.0.1"},
+		Body:            "invalid",
+		IsBase64Encoded: true,
+	})
+	assert.Error(err)
+
+	values := map[string]interface{}{}
+	for _, f := range fields {
+		values[f.Key] = f.Value
+	}
+	assert.Equal("/{proxy+}", values["route"])
+	assert.Equal("10.0.0.2", values["sourceIp"])
+	assert.Equal(0, values["status"])
+	assert.Equal(err.Error(), values["error"])
+}
+
+func TestAccessLogPanic(t *testing.T) {
+	assert := assert.New(t)
+
+	var fields []Field
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	}), WithAccessLog(FieldLoggerFunc(func(msg string, f ...Field) {
+		fields = f
+	})))
+	assert.PanicsWithValue("boom", func() {
+		h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/"})
+	})
+
+	values := map[string]interface{}{}
+	for _, f := range fields {
+		values[f.Key] = f.Value
+	}
+	assert.Equal(http.StatusInternalServerError, values["status"])
+	assert.Equal(0, values["size"])
+	assert.Equal("http.Handler panicked", values["error"])
+}
+
+func TestAccessLogWriter(t *testing.T) {
+	start := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	fields := []Field{
+		{"time", start},
+		{"method", "GET"},
+		{"path", "/items"},
+		{"protocol", "HTTP/1.1"},
+		{"status", 200},
+		{"size", 42},
+		{"sourceIp", "10.0.0.1"},
+		{"userAgent", `test "agent"`},
+		{"referer", ""},
+		{"error", errors.New("boom").Error()},
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		NewAccessLogWriter(&buf, AccessLogJSON).Log("access", fields...)
+
+		line := buf.String()
+		assert.True(t, strings.HasPrefix(line, `{"msg":"access","time":"2023-01-02T03:04:05Z","method":"GET",`))
+		assert.True(t, strings.HasSuffix(line, "}\n"))
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		assert.Equal(t, float64(200), record["status"])
+		assert.Equal(t, "boom", record["error"])
+	})
+
+	t.Run("combined", func(t *testing.T) {
+		var buf bytes.Buffer
+		NewAccessLogWriter(&buf, AccessLogCombined).Log("access", fields...)
+		assert.Equal(t,
+			`10.0.0.1 - - [02/Jan/2023:03:04:05 +0000] "GET /items HTTP/1.1" 200 42 "-" "test \"agent\""`+"\n",
+			buf.String())
+
+		buf.Reset()
+		NewAccessLogWriter(&buf, AccessLogCombined).Log("access", Field{"method", "GET"}, Field{"path", "/"},
+			Field{"status", 204}, Field{"size", 0})
+		assert.Equal(t, `- - - [01/Jan/0001:00:00:00 +0000] "GET /" 204 - "-" "-"`+"\n", buf.String())
+	})
+}
@@ -1,6 +1,11 @@
 package lambada
 
 import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/rajarathnabalan/lambada/jwtclaims"
 )
@@ -9,6 +14,8 @@ import (
 // This struct is both compatible with V1 (Lambda Proxy Integration) and V2 (HTTP API) events and is basically a merge
 // of the `APIGatewayProxyRequest` and `APIGatewayV2HTTPRequest` structs defined in the
 // `github.com/aws/aws-lambda-go/events` package.
+// ALB target group events and Lambda Function URL events, which are respectively similar to V1 and V2 events, are
+// also supported.
 type Request struct {
 	// V1 Only
 	Resource                        string              `json:"resource"` // The resource path defined in API Gateway
@@ -34,6 +41,22 @@ type Request struct {
 	RequestContext        RequestContext    `json:"requestContext"`
 }
 
+// header returns the first value of the named request header.
+// The lookup is case insensitive, and is done in MultiValueHeaders first, then in Headers.
+func (r *Request) header(name string) string {
+	for k, v := range r.MultiValueHeaders {
+		if len(v) > 0 && strings.EqualFold(k, name) {
+			return v[0]
+		}
+	}
+	for k, v := range r.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
 // RequestContext contains the information to identify the AWS account and resources invoking the Lambda function.
 // This struct is both compatible with V1 (Lambda Proxy Integration) and V2 (HTTP API) events and is basically a merge
 // of the `APIGatewayProxyRequestContext` and `APIGatewayV2HTTPRequestContext` structs defined in the
@@ -55,6 +78,9 @@ type RequestContext struct {
 	TimeEpoch int64                                                `json:"timeEpoch"`
 	HTTP      events.APIGatewayV2HTTPRequestContextHTTPDescription `json:"http"`
 
+	// ALB Only
+	ELB *events.ELBContext `json:"elb,omitempty"`
+
 	// V1 + V2
 	AccountID    string      `json:"accountId"`
 	Stage        string      `json:"stage"`
@@ -83,8 +109,192 @@ type Response struct {
 
 // Authorizer contains authorizer details
 type Authorizer struct {
+	// V2 Only
 	IAM *IAMAuthorizer `json:"iam,omitempty"`
 	JWT *JWTAuthorizer `json:"jwt,omitempty"`
+
+	// V1 Only
+	Claims             jwtclaims.Claims `json:"claims,omitempty"`             // The claims of the Cognito User Pools authorizer
+	PrincipalID        string           `json:"principalId,omitempty"`        // The principal id returned by the Lambda authorizer
+	IntegrationLatency int64            `json:"integrationLatency,omitempty"` // The duration of the Lambda authorizer, in milliseconds
+
+	// V1 + V2
+	// The context returned by the Lambda authorizer. V1 events hold it in the authorizer object itself, along with
+	// principalId, while V2 events hold it in the lambda object.
+	Lambda LambdaAuthorizerContext `json:"lambda,omitempty"`
+}
+
+// authorizerKeys are the keys of the V1 authorizer object which are not part of the Lambda authorizer context.
+var authorizerKeys = map[string]struct{}{
+	"iam":                {},
+	"jwt":                {},
+	"claims":             {},
+	"principalId":        {},
+	"integrationLatency": {},
+}
+
+// UnmarshalJSON decodes an authorizer.
+// The values of the V1 claims which are not strings (e.g. lists) are kept as JSON. The numbers of the Lambda
+// authorizer context are decoded as json.Number.
+func (a *Authorizer) UnmarshalJSON(data []byte) error {
+	type authorizer Authorizer
+	var raw struct {
+		authorizer
+		Claims json.RawMessage `json:"claims,omitempty"`
+		Lambda json.RawMessage `json:"lambda,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*a = Authorizer(raw.authorizer)
+
+	var claims map[string]json.RawMessage
+	if err := json.Unmarshal(raw.Claims, &claims); err == nil && claims != nil {
+		a.Claims = make(jwtclaims.Claims, len(claims))
+		for k, v := range claims {
+			var s string
+			if err := json.Unmarshal(v, &s); err != nil {
+				s = string(v)
+			}
+			a.Claims[k] = s
+		}
+	}
+
+	if a.PrincipalID == "" {
+		// V2: the context is held by the lambda object, if any
+		if err := decodeJSONNumbers(raw.Lambda, &a.Lambda); err != nil {
+			a.Lambda = nil
+		}
+		return nil
+	}
+
+	// V1: the context is merged into the authorizer object
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for k, v := range fields {
+		if _, ok := authorizerKeys[k]; ok {
+			continue
+		}
+		var value interface{}
+		if err := decodeJSONNumbers(v, &value); err != nil {
+			return err
+		}
+		if a.Lambda == nil {
+			a.Lambda = make(LambdaAuthorizerContext, len(fields))
+		}
+		a.Lambda[k] = value
+	}
+	return nil
+}
+
+// MarshalJSON encodes an authorizer.
+// When PrincipalID is set, the authorizer is encoded using the V1 format, i.e. with the Lambda authorizer context merged
+// into the authorizer object.
+func (a Authorizer) MarshalJSON() ([]byte, error) {
+	type authorizer Authorizer
+	if a.PrincipalID == "" || len(a.Lambda) == 0 {
+		return json.Marshal(authorizer(a))
+	}
+
+	lambdaContext := a.Lambda
+	a.Lambda = nil
+	data, err := json.Marshal(authorizer(a))
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range lambdaContext {
+		if _, ok := authorizerKeys[k]; !ok {
+			fields[k] = v
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// decodeJSONNumbers decodes data into v, decoding the numbers as json.Number.
+func decodeJSONNumbers(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// LambdaAuthorizerContext is the context returned by a Lambda authorizer.
+// Numbers are decoded as json.Number. REST APIs (V1) pass all the values as strings: the typed accessors convert them
+// as needed.
+type LambdaAuthorizerContext map[string]interface{}
+
+// String returns the value of key as a string. Numbers and booleans are formatted.
+func (c LambdaAuthorizerContext) String(key string) (string, bool) {
+	switch v := c[key].(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// Int64 returns the value of key as an integer. Strings holding integers are parsed.
+func (c LambdaAuthorizerContext) Int64(key string) (int64, bool) {
+	switch v := c[key].(type) {
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	case float64:
+		return int64(v), v == float64(int64(v))
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// Float64 returns the value of key as a floating-point number. Strings holding numbers are parsed.
+func (c LambdaAuthorizerContext) Float64(key string) (float64, bool) {
+	switch v := c[key].(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Bool returns the value of key as a boolean. Strings holding booleans (e.g. "true") are parsed.
+func (c LambdaAuthorizerContext) Bool(key string) (bool, bool) {
+	switch v := c[key].(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(v)
+		return b, err == nil
+	}
+	return false, false
 }
 
 // IAMAuthorizer contains the details of a request authenticated using the AWS SignV4 authorizer.
@@ -3,6 +3,7 @@ package lambada
 import (
 	"encoding/base64"
 	"strings"
+	"unicode/utf8"
 )
 
 // bodyToBytes converts the API Gateway request body into a byte slice.
@@ -14,6 +15,84 @@ func bodyToBytes(body string, isBase64 bool) ([]byte, error) {
 	return ([]byte)(body), nil
 }
 
+// requestBodyDecoder decodes API Gateway V1 request bodies, validating the IsBase64Encoded flag against the API's
+// binaryMediaTypes configuration.
+// A nil *requestBodyDecoder simply trusts the IsBase64Encoded flag.
+type requestBodyDecoder struct {
+	detectors   []binDetector
+	logger      Logger
+	decodeTwice bool
+}
+
+// bodyToBytes converts the body of req into a byte slice.
+// When the body is expected to be binary (i.e. its Content-Type matches one of the configured binaryMediaTypes), the
+// following mismatches are reported to the logger:
+//   - The body is not Base64 encoded: it has been passed as text by API Gateway, and may be corrupted if it contained
+//     bytes which are not valid UTF-8.
+//   - The decoded body looks Base64 encoded (e.g. the client already encoded it). As valid bodies may look Base64
+//     encoded too, the body is only decoded a second time if decodeTwice is set (see WithRequestDoubleBase64Decoding).
+//
+// When the body is not expected to be binary but is Base64 encoded anyway, the mismatch is reported and the body is
+// decoded.
+func (d *requestBodyDecoder) bodyToBytes(req *Request) ([]byte, error) {
+	body, err := bodyToBytes(req.Body, req.IsBase64Encoded)
+	if d == nil || err != nil || req.Body == "" {
+		return body, err
+	}
+
+	contentType := req.header("Content-Type")
+	mediaType, params := parseMediaType(contentType)
+	typ, subTyp, _ := strings.Cut(mediaType, "/")
+	expectBinary := false
+	for _, detector := range d.detectors {
+		if detector.isBinary(mediaType, typ, subTyp, params) == bsBinary {
+			expectBinary = true
+			break
+		}
+	}
+
+	switch {
+	case expectBinary && !req.IsBase64Encoded:
+		if strings.ContainsRune(req.Body, utf8.RuneError) {
+			d.logger.Printf("Request body mismatch: binary Content-Type %q received as text, the body is likely corrupted\n", contentType)
+		} else {
+			d.logger.Printf("Request body mismatch: binary Content-Type %q received as text\n", contentType)
+		}
+
+	case expectBinary && isBase64(body):
+		if !d.decodeTwice {
+			d.logger.Printf("Request body mismatch: body with Content-Type %q may be double Base64 encoded\n", contentType)
+			break
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(body))
+		if err == nil {
+			d.logger.Printf("Request body mismatch: double Base64 encoded body with Content-Type %q, decoding again\n", contentType)
+			body = decoded
+		}
+
+	case !expectBinary && req.IsBase64Encoded:
+		d.logger.Printf("Request body mismatch: text Content-Type %q received Base64 encoded\n", contentType)
+	}
+
+	return body, nil
+}
+
+// isBase64 returns whether data looks like standard, padded Base64 encoded data.
+func isBase64(data []byte) bool {
+	if len(data) == 0 || len(data)%4 != 0 {
+		return false
+	}
+	for i, b := range data {
+		switch {
+		case b >= 'A' && b <= 'Z', b >= 'a' && b <= 'z', b >= '0' && b <= '9', b == '+', b == '/':
+		case b == '=' && i >= len(data)-2:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // bytesToBody converts a byte slice to a API Gateway response body.
 // If isBase64 is true, the bytes are encoded to Base64.
 func bytesToBody(bytes []byte, isBase64 bool) string {
@@ -23,33 +102,104 @@ func bytesToBody(bytes []byte, isBase64 bool) string {
 	return string(bytes)
 }
 
-// isBinary attempts to detect whether content represented by contentType and contentEncoding is binary or text.
+// isBinary attempts to detect whether content represented by contentType and contentEncoding is binary or text,
+// using the built-in rules only.
 func isBinary(contentType, contentEncoding string) binaryStatus {
+	status, _ := detectBinary(contentType, contentEncoding, nil)
+	return status
+}
+
+// detectBinary attempts to detect whether content represented by contentType and contentEncoding is binary or text.
+// The custom detectors are evaluated, in order, prior to the built-in ones.
+// detectBinary also returns a description of the rule which made the decision (see ResponseWriter.BinaryRule).
+func detectBinary(contentType, contentEncoding string, custom []binDetector) (binaryStatus, string) {
 	// A non-empty content encoding means binary (i.e. deflate, gzip, br)
 	if contentEncoding != "" {
-		return bsBinary
+		return bsBinary, BinaryRuleContentEncoding
 	}
 
-	// Discard anything before ;
-	base, _, _ := strings.Cut(contentType, ";")
-	mediaType := strings.TrimSpace(strings.ToLower(base))
+	mediaType, params := parseMediaType(contentType)
 	// Split between type and subtype (e.g text/plain)
 	typ, subTyp, _ := strings.Cut(mediaType, "/")
 
-	for _, detector := range binDetectors {
-		status := detector.isBinary(mediaType, typ, subTyp)
-		switch status {
-		case bsBinary:
-			return bsBinary
-		case bsText:
-			return bsText
-		}
+	if status, rule := runBinDetectors(custom, "custom:", mediaType, typ, subTyp, params); status != bsUnknown {
+		return status, rule
+	}
+	if status, rule := runBinDetectors(binDetectors, "builtin:", mediaType, typ, subTyp, params); status != bsUnknown {
+		return status, rule
 	}
 
 	// We were not able to guess if this is binary or not, return the default
-	return bsUnknown
+	return bsUnknown, BinaryRuleDefault
+}
+
+// DetectBinary runs the automatic binary detection (see Automatic) for a response with the given Content-Type and
+// Content-Encoding, using the media types registered by options (see WithBinaryMediaTypes and WithTextMediaTypes).
+// It returns whether such a response would be sent in binary mode, and the rule which decided it (see
+// ResponseWriter.BinaryRule). When no rule matches, the default binary mode set by WithDefaultBinary is returned.
+//
+// Within an http.Handler, ResponseWriter.DetectBinary uses the options of the handler.
+func DetectBinary(contentType, contentEncoding string, options ...Option) (bool, string) {
+	o := newOptions(options...)
+	return resolveBinary(contentType, contentEncoding, o.binDetectors, o.defaultBinary)
 }
 
+// resolveBinary runs detectBinary, returning defaultBinary when no rule matches.
+func resolveBinary(contentType, contentEncoding string, custom []binDetector, defaultBinary bool) (bool, string) {
+	switch status, rule := detectBinary(contentType, contentEncoding, custom); status {
+	case bsBinary:
+		return true, rule
+	case bsText:
+		return false, rule
+	default:
+		return defaultBinary, rule
+	}
+}
+
+// runBinDetectors runs detectors in order and returns the status given by the first one able to make a decision,
+// along with the rule description (prefix followed by the detector's pattern).
+func runBinDetectors(detectors []binDetector, prefix, mediaType, typ, subTyp string, params map[string]string) (binaryStatus, string) {
+	for _, detector := range detectors {
+		switch status := detector.isBinary(mediaType, typ, subTyp, params); status {
+		case bsBinary, bsText:
+			return status, prefix + detector.String()
+		}
+	}
+	return bsUnknown, ""
+}
+
+// parseMediaType splits a Content-Type header value into a lower-cased media type and its parameters.
+// Parameter names are lower-cased, and values are unquoted.
+func parseMediaType(contentType string) (string, map[string]string) {
+	base, rawParams, _ := strings.Cut(contentType, ";")
+	mediaType := strings.TrimSpace(strings.ToLower(base))
+
+	var params map[string]string
+	for _, param := range strings.Split(rawParams, ";") {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		if params == nil {
+			params = map[string]string{}
+		}
+		params[strings.TrimSpace(strings.ToLower(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return mediaType, params
+}
+
+// Rules reported by ResponseWriter.BinaryRule which are not tied to a media type.
+const (
+	// BinaryRuleDefault means no rule matched, and the default binary mode was used.
+	BinaryRuleDefault = "default"
+
+	// BinaryRuleForced means the binary mode has been set manually, using SetBinary or SetText.
+	BinaryRuleForced = "forced"
+
+	// BinaryRuleContentEncoding means the response was considered binary because of its Content-Encoding header.
+	BinaryRuleContentEncoding = "content-encoding"
+)
+
 type binaryStatus int8
 
 const (
@@ -59,7 +209,10 @@ const (
 )
 
 type binDetector interface {
-	isBinary(mediaType, typ, subTyp string) binaryStatus
+	isBinary(mediaType, typ, subTyp string, params map[string]string) binaryStatus
+
+	// String returns the pattern matched by the detector, using the API Gateway binaryMediaTypes syntax.
+	String() string
 }
 
 type typeBinDetector struct {
@@ -67,37 +220,99 @@ type typeBinDetector struct {
 	status binaryStatus
 }
 
-func (m *typeBinDetector) isBinary(mediaType, typ, subTyp string) binaryStatus {
+func (m *typeBinDetector) isBinary(mediaType, typ, subTyp string, params map[string]string) binaryStatus {
 	if typ == m.typ {
 		return m.status
 	}
 	return bsUnknown
 }
 
+func (m *typeBinDetector) String() string {
+	return m.typ + "/*"
+}
+
 type mediaTypeBinDetector struct {
 	mediaType string
 	status    binaryStatus
 }
 
-func (m *mediaTypeBinDetector) isBinary(mediaType, typ, subTyp string) binaryStatus {
+func (m *mediaTypeBinDetector) isBinary(mediaType, typ, subTyp string, params map[string]string) binaryStatus {
 	if mediaType == m.mediaType {
 		return m.status
 	}
 	return bsUnknown
 }
 
+func (m *mediaTypeBinDetector) String() string {
+	return m.mediaType
+}
+
 type mediaTypeSuffixBinDetector struct {
 	suffix string
 	status binaryStatus
 }
 
-func (m *mediaTypeSuffixBinDetector) isBinary(mediaType, typ, subTyp string) binaryStatus {
+func (m *mediaTypeSuffixBinDetector) isBinary(mediaType, typ, subTyp string, params map[string]string) binaryStatus {
 	if strings.HasSuffix(mediaType, m.suffix) {
 		return m.status
 	}
 	return bsUnknown
 }
 
+func (m *mediaTypeSuffixBinDetector) String() string {
+	return "*/*" + m.suffix
+}
+
+// patternBinDetector matches media types against a pattern following the API Gateway binaryMediaTypes syntax.
+// Supported patterns are exact media types (application/x-ndjson), type wildcards (image/*), the catch-all */*, and
+// suffixes (application/*+json or */*+json).
+// Patterns may include parameters (text/csv;charset=binary), in which case all of them must be present with the same
+// value in the matched content type.
+type patternBinDetector struct {
+	pattern string
+	typ     string
+	subTyp  string
+	params  map[string]string
+	status  binaryStatus
+}
+
+func newPatternBinDetector(pattern string, status binaryStatus) *patternBinDetector {
+	mediaType, params := parseMediaType(pattern)
+	typ, subTyp, _ := strings.Cut(mediaType, "/")
+	return &patternBinDetector{
+		pattern: pattern,
+		typ:     typ,
+		subTyp:  subTyp,
+		params:  params,
+		status:  status,
+	}
+}
+
+func (m *patternBinDetector) isBinary(mediaType, typ, subTyp string, params map[string]string) binaryStatus {
+	if m.typ != "*" && m.typ != typ {
+		return bsUnknown
+	}
+	switch {
+	case m.subTyp == "*":
+	case strings.HasPrefix(m.subTyp, "*+"):
+		if !strings.HasSuffix(subTyp, m.subTyp[1:]) {
+			return bsUnknown
+		}
+	case m.subTyp != subTyp:
+		return bsUnknown
+	}
+	for k, v := range m.params {
+		if !strings.EqualFold(params[k], v) {
+			return bsUnknown
+		}
+	}
+	return m.status
+}
+
+func (m *patternBinDetector) String() string {
+	return m.pattern
+}
+
 var binDetectors = []binDetector{
 	// text/ is known to be text
 	&typeBinDetector{
@@ -1,10 +1,15 @@
 package lambada
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBodyToBytes(t *testing.T) {
@@ -130,3 +135,126 @@ func TestIsBinary(t *testing.T) {
 		})
 	}
 }
+
+func TestDetectBinaryCustom(t *testing.T) {
+	custom := newOptions(
+		WithTextMediaTypes("application/x-ndjson", "application/*+cbor-text"),
+		WithBinaryMediaTypes("text/csv;charset=binary", "application/vnd.our-format", "*/*+cbor"),
+	).binDetectors
+
+	cases := []struct {
+		contentType string
+		status      binaryStatus
+		rule        string
+	}{
+		{contentType: "application/x-ndjson", status: bsText, rule: "custom:application/x-ndjson"},
+		{contentType: "application/vnd.our-format; version=2", status: bsBinary, rule: "custom:application/vnd.our-format"},
+		{contentType: "text/csv; charset=\"BINARY\"", status: bsBinary, rule: "custom:text/csv;charset=binary"},
+		{contentType: "text/csv; charset=utf-8", status: bsText, rule: "builtin:text/*"},
+		{contentType: "application/vnd.a+cbor", status: bsBinary, rule: "custom:*/*+cbor"},
+		{contentType: "application/vnd.a+cbor-text", status: bsText, rule: "custom:application/*+cbor-text"},
+		{contentType: "application/problem+json", status: bsText, rule: "builtin:*/*+json"},
+		{contentType: "application/pdf", status: bsBinary, rule: "builtin:application/*"},
+		{contentType: "unknown/unknown", status: bsUnknown, rule: BinaryRuleDefault},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, c.contentType), func(t *testing.T) {
+			assert := assert.New(t)
+			status, rule := detectBinary(c.contentType, "", custom)
+			assert.Equal(c.status, status)
+			assert.Equal(c.rule, rule)
+		})
+	}
+}
+
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Printf(format string, args ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func TestRequestBodyDecoder(t *testing.T) {
+	cases := []struct {
+		contentType string
+		body        string
+		isBase64    bool
+		expected    []byte
+		logged      bool
+	}{
+		// Expected cases
+		{contentType: "image/png", body: "AQID", isBase64: true, expected: []byte{1, 2, 3}},
+		{contentType: "application/json", body: `{"a":1}`, isBase64: false, expected: []byte(`{"a":1}`)},
+		// Double encoded: reported only
+		{contentType: "image/png", body: "QVFJRA==", isBase64: true, expected: []byte("AQID"), logged: true},
+		// Valid bodies looking Base64 encoded are left unchanged
+		{contentType: "image/png", body: "dGVzdA==", isBase64: true, expected: []byte("test"), logged: true},
+		{contentType: "image/png", body: "YWJjZA==", isBase64: true, expected: []byte("abcd"), logged: true},
+		// Binary passed as text
+		{contentType: "image/png", body: "�PNG", isBase64: false, expected: []byte("�PNG"), logged: true},
+		// Text encoded as Base64
+		{contentType: "application/json", body: "e30=", isBase64: true, expected: []byte("{}"), logged: true},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, c.contentType), func(t *testing.T) {
+			assert := assert.New(t)
+
+			logger := &recordingLogger{}
+			d := newOptions(WithRequestLogger(logger), WithRequestBinaryMediaTypes("image/*")).requestBodyDecoder
+			data, err := d.bodyToBytes(&Request{
+				Headers:         map[string]string{"content-type": c.contentType},
+				Body:            c.body,
+				IsBase64Encoded: c.isBase64,
+			})
+			assert.NoError(err)
+			assert.Equal(c.expected, data)
+			assert.Equal(c.logged, len(logger.messages) > 0, logger.messages)
+		})
+	}
+}
+
+func TestRequestBodyDecoderUnchanged(t *testing.T) {
+	// With */* binaryMediaTypes, every body is Base64 encoded by API Gateway
+	for _, body := range []string{"test", "abcd"} {
+		var received []byte
+		h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received, _ = io.ReadAll(r.Body)
+		}), WithRequestBinaryMediaTypes("*/*"))
+		_, err := h(context.Background(), Request{
+			HTTPMethod:      http.MethodPost,
+			Path:            "/",
+			Headers:         map[string]string{"content-type": "text/plain"},
+			Body:            base64.StdEncoding.EncodeToString([]byte(body)),
+			IsBase64Encoded: true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, body, string(received))
+	}
+}
+
+func TestRequestBodyDecoderDecodeTwice(t *testing.T) {
+	assert := assert.New(t)
+
+	logger := &recordingLogger{}
+	d := newOptions(WithRequestLogger(logger), WithRequestBinaryMediaTypes("*/*"), WithRequestDoubleBase64Decoding()).requestBodyDecoder
+	data, err := d.bodyToBytes(&Request{
+		Headers:         map[string]string{"content-type": "image/png"},
+		Body:            "QVFJRA==",
+		IsBase64Encoded: true,
+	})
+	assert.NoError(err)
+	assert.Equal([]byte{1, 2, 3}, data)
+	assert.Len(logger.messages, 1)
+}
+
+func TestRequestBodyDecoderNil(t *testing.T) {
+	assert := assert.New(t)
+
+	var d *requestBodyDecoder
+	data, err := d.bodyToBytes(&Request{Body: "QVFJRA==", IsBase64Encoded: true})
+	assert.NoError(err)
+	assert.Equal([]byte("AQID"), data)
+}
@@ -0,0 +1,64 @@
+package lambada
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// CaptureRecord is a record written by the capture option (see WithCapture).
+// Each record contains the raw Lambda event and either the produced response, the error returned to Lambda, or
+// whether the http.Handler panicked.
+type CaptureRecord struct {
+	Event    Request   `json:"event"`
+	Response *Response `json:"response,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Panic    bool      `json:"panic,omitempty"`
+}
+
+// capture writes CaptureRecord as JSON Lines.
+type capture struct {
+	mu       sync.Mutex
+	enc      *json.Encoder
+	redactor *redactor
+}
+
+// WithCapture writes every invocation to w as JSON Lines: each line is a CaptureRecord containing the raw event and
+// the produced response. The resulting file can be replayed using the replay package or the lambada replay command.
+//
+// The values of redactHeaders (and cookies, when the Cookie or Set-Cookie headers are listed) are replaced by
+// Redacted. If redactHeaders is empty, DefaultRedactedHeaders are redacted.
+func WithCapture(w io.Writer, redactHeaders ...string) Option {
+	if len(redactHeaders) == 0 {
+		redactHeaders = DefaultRedactedHeaders
+	}
+	c := &capture{
+		enc:      json.NewEncoder(w),
+		redactor: newRedactor(redactHeaders),
+	}
+	return func(o *options) {
+		o.capture = c
+	}
+}
+
+// record writes a record. res is ignored if err is not nil or if the handler panicked.
+// Errors writing the record are ignored.
+func (c *capture) record(event Request, res *Response, err error, panicked bool) {
+	rec := CaptureRecord{
+		Event: c.redactor.redactRequest(event),
+		Panic: panicked,
+	}
+	switch {
+	case panicked:
+		// Neither a response nor an error has been produced
+	case err != nil:
+		rec.Error = err.Error()
+	case res != nil:
+		redacted := c.redactor.redactResponse(*res)
+		rec.Response = &redacted
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enc.Encode(&rec)
+}
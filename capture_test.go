@@ -0,0 +1,79 @@
+package lambada
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapture(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var buf bytes.Buffer
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		w.Write([]byte("Hello"))
+	}), WithCapture(&buf))
+
+	req := Request{
+		HTTPMethod: http.MethodGet,
+		Path:       "/",
+		Headers:    map[string]string{"authorization": "Bearer token", "x-test": "value"},
+	}
+	_, err := h(context.Background(), req)
+	require.NoError(err)
+	_, err = h(context.Background(), Request{HTTPMethod: http.MethodGet, Body: "invalid", IsBase64Encoded: true})
+	require.Error(err)
+
+	// The original event is left untouched
+	assert.Equal("Bearer token", req.Headers["authorization"])
+
+	dec := json.NewDecoder(&buf)
+	var rec CaptureRecord
+	require.NoError(dec.Decode(&rec))
+	assert.Equal(Redacted, rec.Event.Headers["authorization"])
+	assert.Equal("value", rec.Event.Headers["x-test"])
+	assert.Equal("", rec.Event.RequestContext.DomainName)
+	require.NotNil(rec.Response)
+	assert.Equal("Hello", rec.Response.Body)
+	assert.Equal([]string{Redacted}, rec.Response.MultiValueHeaders["Set-Cookie"])
+
+	rec = CaptureRecord{}
+	require.NoError(dec.Decode(&rec))
+	assert.Nil(rec.Response)
+	assert.NotEmpty(rec.Error)
+}
+
+func TestCapturePanic(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var buf bytes.Buffer
+	logger := &recordingLogger{}
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), WithCapture(&buf), WithResponseLogger(logger))
+
+	assert.PanicsWithValue("boom", func() {
+		h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/"})
+	})
+
+	var rec CaptureRecord
+	require.NoError(json.NewDecoder(&buf).Decode(&rec))
+	assert.True(rec.Panic)
+	assert.Nil(rec.Response)
+	assert.Empty(rec.Error)
+	// No response is logged
+	assert.Empty(logger.messages)
+}
+
+func TestRedactCookies(t *testing.T) {
+	assert.Equal(t, []string{"a=" + Redacted, "b=" + Redacted}, redactCookies([]string{"a=1", "b=2; Path=/"}))
+	assert.Nil(t, redactCookies(nil))
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/rajarathnabalan/lambada"
+	"github.com/rajarathnabalan/lambada/jwtclaims"
+	"github.com/rajarathnabalan/lambada/lambadatest"
+)
+
+const eventUsage = `Usage: lambada event [flags] <url>
+
+Event prints a Lambda event built from curl-like arguments, suitable for sam local invoke, lambada replay or unit test
+fixtures. Flags may be placed before or after the URL.
+
+Example:
+
+	lambada event -X POST -H 'Content-Type: application/json' -d '{"name":"item"}' --format v1 https://api.example.com/items
+
+Flags:
+`
+
+// stringsFlag is a repeatable string flag
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func runEvent(args []string) int {
+	event, err := buildEvent(args, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lambada event: %v\n", err)
+		return 1
+	}
+
+	data, err := json.MarshalIndent(&event, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lambada event: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(data))
+	return 0
+}
+
+// buildEvent builds an event from the command line arguments. Usage and parsing errors are written to output.
+func buildEvent(args []string, output io.Writer) (lambada.Request, error) {
+	flags := flag.NewFlagSet("event", flag.ContinueOnError)
+	flags.SetOutput(output)
+	method := flags.String("X", "", "request method (default GET, or POST when -d is used)")
+	var headers, cookies stringsFlag
+	flags.Var(&headers, "H", "request header, as 'Name: value' (repeatable)")
+	flags.Var(&cookies, "cookie", "request cookie, as 'name=value' (repeatable)")
+	data := flags.String("d", "", "request body, or @file to read it from a file")
+	binary := flags.Bool("binary", false, "always Base64 encode the body")
+	formatName := flags.String("format", "v2", "event format: v1, v2, alb or url")
+	claims := flags.String("jwt-claims", "", "JWT (v2) or Cognito (v1) authorizer claims, as a JSON object")
+	stage := flags.String("stage", "", "API Gateway stage (default $default)")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), eventUsage)
+		flags.PrintDefaults()
+	}
+
+	// Allow flags after the URL
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return lambada.Request{}, err
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(positional) != 1 {
+		flags.Usage()
+		return lambada.Request{}, flag.ErrHelp
+	}
+
+	format, err := lambada.ParseEventFormat(*formatName)
+	if err != nil {
+		return lambada.Request{}, err
+	}
+
+	dataSet := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "d" {
+			dataSet = true
+		}
+	})
+	if *method == "" {
+		*method = http.MethodGet
+		if dataSet {
+			*method = http.MethodPost
+		}
+	}
+
+	b := lambadatest.NewEvent(format, strings.ToUpper(*method), positional[0]).Stage(*stage)
+
+	contentType := ""
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return lambada.Request{}, fmt.Errorf("invalid header %q", h)
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if strings.EqualFold(name, "Content-Type") {
+			contentType = value
+			continue
+		}
+		b.Header(name, value)
+	}
+	for _, c := range cookies {
+		name, value, ok := strings.Cut(c, "=")
+		if !ok {
+			return lambada.Request{}, fmt.Errorf("invalid cookie %q", c)
+		}
+		b.Cookie(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	if dataSet {
+		body := []byte(*data)
+		if strings.HasPrefix(*data, "@") {
+			if body, err = os.ReadFile(strings.TrimPrefix(*data, "@")); err != nil {
+				return lambada.Request{}, err
+			}
+		}
+		if contentType == "" {
+			// Same default as curl
+			contentType = "application/x-www-form-urlencoded"
+		}
+		if *binary {
+			b.Binary(contentType, body)
+		} else {
+			b.Body(contentType, body)
+		}
+	} else if contentType != "" {
+		b.Header("Content-Type", contentType)
+	}
+
+	if *claims != "" {
+		var c jwtclaims.Claims
+		if err := json.Unmarshal([]byte(*claims), &c); err != nil {
+			return lambada.Request{}, fmt.Errorf("invalid authorizer claims: %w", err)
+		}
+		b.Claims(c)
+	}
+
+	return b.Build()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildEvent(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	event, err := buildEvent([]string{
+		"--format", "v1",
+		"https://api.example.com/items?a=1",
+		"-H", "X-Test: value",
+		"-d", "name=item",
+		"--cookie", "session=xyz",
+		"--jwt-claims", `{"sub":"user"}`,
+	}, io.Discard)
+	require.NoError(err)
+	assert.Equal(http.MethodPost, event.HTTPMethod)
+	assert.Equal("/items", event.Path)
+	assert.Equal("1", event.QueryStringParameters["a"])
+	assert.Equal("value", event.Headers["X-Test"])
+	assert.Equal("session=xyz", event.Headers["Cookie"])
+	assert.Equal("application/x-www-form-urlencoded", event.Headers["Content-Type"])
+	// Like API Gateway, form bodies are Base64 encoded
+	assert.True(event.IsBase64Encoded)
+	assert.Equal(base64.StdEncoding.EncodeToString([]byte("name=item")), event.Body)
+	assert.Nil(event.RequestContext.Authorizer.JWT)
+	assert.Equal("user", event.RequestContext.Authorizer.Claims.Sub())
+
+	name := filepath.Join(t.TempDir(), "body.bin")
+	require.NoError(os.WriteFile(name, []byte{0, 1, 2}, 0o600))
+	event, err = buildEvent([]string{"-X", "put", "--binary", "-H", "Content-Type: text/plain", "-d", "@" + name, "http://localhost/upload"}, io.Discard)
+	require.NoError(err)
+	assert.Equal("2.0", event.Version)
+	assert.Equal(http.MethodPut, event.RequestContext.HTTP.Method)
+	assert.True(event.IsBase64Encoded)
+	assert.Equal("AAEC", event.Body)
+	assert.Equal("text/plain", event.Headers["content-type"])
+
+	_, err = buildEvent([]string{"--format", "v3", "http://localhost/"}, io.Discard)
+	assert.Error(err)
+	_, err = buildEvent([]string{"-H", "invalid", "http://localhost/"}, io.Discard)
+	assert.Error(err)
+	_, err = buildEvent([]string{"--format", "alb", "--jwt-claims", `{"sub":"user"}`, "http://localhost/"}, io.Discard)
+	assert.Error(err)
+	_, err = buildEvent(nil, io.Discard)
+	assert.Error(err)
+}
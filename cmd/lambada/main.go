@@ -0,0 +1,52 @@
+// Command lambada provides development tools for lambada based Lambda functions.
+//
+// Usage:
+//
+//	lambada <command> [arguments]
+//
+// The commands are:
+//
+//	event     print an event built from curl-like arguments
+//	replay    replay captured events through a handler built in a test binary
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	short string
+	run   func(args []string) int
+}
+
+var commands = []command{
+	{name: "event", short: "print an event built from curl-like arguments", run: runEvent},
+	{name: "replay", short: "replay captured events through a handler built in a test binary", run: runReplay},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n\n\tlambada <command> [arguments]\n\nThe commands are:\n\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "\t%-9s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "lambada: unknown command %q\n\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/rajarathnabalan/lambada/replay"
+)
+
+const replayUsage = `Usage: lambada replay [flags] <file>
+
+Replay runs the events of file (as written by the lambada.WithCapture option, or logged by the lambada request and
+response loggers) through the handler of a test binary, and reports the differences between the produced responses
+and the recorded ones.
+
+The package given by -pkg must contain a test calling replay.Test, for instance:
+
+	func TestReplay(t *testing.T) {
+		replay.Test(t, newHandler())
+	}
+
+Flags:
+`
+
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	pkg := flags.String("pkg", ".", "package containing the replay test")
+	run := flags.String("run", "TestReplay", "name of the replay test")
+	verbose := flags.Bool("v", false, "verbose output")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), replayUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	file, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lambada replay: %v\n", err)
+		return 1
+	}
+	if _, err := replay.ReadFile(file); err != nil {
+		fmt.Fprintf(os.Stderr, "lambada replay: %s: %v\n", file, err)
+		return 1
+	}
+
+	goArgs := []string{"test", "-count=1", "-run", "^" + *run + "$"}
+	if *verbose {
+		goArgs = append(goArgs, "-v")
+	}
+	goArgs = append(goArgs, *pkg)
+
+	cmd := exec.Command("go", goArgs...)
+	cmd.Env = append(os.Environ(), replay.FileEnv+"="+file)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		fmt.Fprintf(os.Stderr, "lambada replay: %v\n", err)
+		return 1
+	}
+	return 0
+}
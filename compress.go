@@ -0,0 +1,245 @@
+package lambada
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/morelj/httptools/header"
+)
+
+// DefaultCompressionMinSize is the default minimum body size, in bytes, below which responses are not compressed.
+const DefaultCompressionMinSize = 1024
+
+// An Encoder compresses response bodies using a specific content coding.
+// Lambada provides GzipEncoder and DeflateEncoder. Other codings (e.g. brotli) can be supported by implementing this
+// interface.
+type Encoder interface {
+	// Encoding returns the content coding name, as used in the Accept-Encoding and Content-Encoding headers
+	// (e.g. gzip).
+	Encoding() string
+
+	// Encode writes the compressed version of data to w.
+	Encode(w io.Writer, data []byte) error
+}
+
+// GzipEncoder is an Encoder using the gzip content coding.
+// Level is the compression level as defined in the compress/gzip package. The zero value uses the default level.
+type GzipEncoder struct {
+	Level int
+}
+
+// Encoding returns gzip.
+func (e GzipEncoder) Encoding() string {
+	return "gzip"
+}
+
+// Encode writes the gzip compressed data to w.
+func (e GzipEncoder) Encode(w io.Writer, data []byte) error {
+	level := e.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	gw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return err
+	}
+	if _, err := gw.Write(data); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// DeflateEncoder is an Encoder using the deflate content coding.
+// Level is the compression level as defined in the compress/flate package. The zero value uses the default level.
+//
+// As mandated by RFC 9110, the compressed data is wrapped into the zlib format.
+type DeflateEncoder struct {
+	Level int
+}
+
+// Encoding returns deflate.
+func (e DeflateEncoder) Encoding() string {
+	return "deflate"
+}
+
+// Encode writes the deflate compressed data to w.
+func (e DeflateEncoder) Encode(w io.Writer, data []byte) error {
+	level := e.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	zw, err := zlib.NewWriterLevel(w, level)
+	if err != nil {
+		return err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// compression holds the response compression settings.
+type compression struct {
+	encoders []Encoder
+	minSize  int
+}
+
+// negotiate returns the encoder to use given the value of the Accept-Encoding request header.
+// Among the acceptable encoders, the one with the highest quality value is returned. Ties are broken using the order
+// of c.encoders.
+// If no encoder is acceptable, nil is returned.
+func (c *compression) negotiate(acceptEncoding string) Encoder {
+	if acceptEncoding == "" {
+		return nil
+	}
+
+	qualities := parseAcceptEncoding(acceptEncoding)
+
+	var best Encoder
+	bestQ := 0.0
+	for _, enc := range c.encoders {
+		q, ok := qualities[strings.ToLower(enc.Encoding())]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best = enc
+			bestQ = q
+		}
+	}
+	return best
+}
+
+// compress compresses body if it is eligible for compression.
+// The returned string is the content coding used, or an empty string if the body has not been compressed.
+func (c *compression) compress(body []byte, contentType, acceptEncoding string) ([]byte, string) {
+	if len(body) < c.minSize || !isCompressible(contentType) {
+		return body, ""
+	}
+
+	enc := c.negotiate(acceptEncoding)
+	if enc == nil {
+		return body, ""
+	}
+
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, body); err != nil {
+		return body, ""
+	}
+	return buf.Bytes(), enc.Encoding()
+}
+
+// parseAcceptEncoding parses the value of an Accept-Encoding header and returns a map of lower-cased content codings
+// to their quality values.
+func parseAcceptEncoding(value string) map[string]float64 {
+	res := map[string]float64{}
+	for _, part := range strings.Split(value, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, val, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(strings.ToLower(name)) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		res[coding] = q
+	}
+	return res
+}
+
+// isCompressible returns whether content of the given type is worth compressing.
+// Text content is always compressible, whereas most binary formats (images, videos, archives...) are already
+// compressed.
+func isCompressible(contentType string) bool {
+	base, _, _ := strings.Cut(contentType, ";")
+	mediaType := strings.TrimSpace(strings.ToLower(base))
+	typ, _, _ := strings.Cut(mediaType, "/")
+
+	if _, ok := incompressibleMediaTypes[mediaType]; ok {
+		return false
+	}
+	switch typ {
+	case "image":
+		// SVG is text
+		return mediaType == "image/svg+xml" || mediaType == "image/bmp" || mediaType == "image/x-icon"
+	case "audio", "video":
+		return false
+	}
+	return true
+}
+
+var incompressibleMediaTypes = map[string]struct{}{
+	"application/gzip":             {},
+	"application/x-gzip":           {},
+	"application/zip":              {},
+	"application/x-bzip2":          {},
+	"application/x-xz":             {},
+	"application/x-7z-compressed":  {},
+	"application/x-rar-compressed": {},
+	"application/vnd.rar":          {},
+	"application/zstd":             {},
+	"application/pdf":              {},
+	"application/octet-stream":     {},
+	"font/woff":                    {},
+	"font/woff2":                   {},
+}
+
+// WithCompression enables response compression.
+// The response body is compressed using the encoder with the highest quality value in the Accept-Encoding request
+// header. Ties are broken using the order of encoders. When compressed, the response is always sent in binary mode.
+// If no encoders are given, GzipEncoder and DeflateEncoder are used.
+//
+// Bodies smaller than DefaultCompressionMinSize, responses already having a Content-Encoding and responses whose
+// content type is known to be already compressed (images, videos, archives...) are left untouched.
+func WithCompression(encoders ...Encoder) Option {
+	return func(o *options) {
+		if len(encoders) == 0 {
+			encoders = []Encoder{GzipEncoder{}, DeflateEncoder{}}
+		}
+		minSize := DefaultCompressionMinSize
+		if o.compression != nil {
+			minSize = o.compression.minSize
+		}
+		o.compression = &compression{
+			encoders: encoders,
+			minSize:  minSize,
+		}
+	}
+}
+
+// WithCompressionMinSize sets the minimum size of the bodies to compress.
+// This option has no effect unless WithCompression is also used.
+func WithCompressionMinSize(minSize int) Option {
+	return func(o *options) {
+		if o.compression == nil {
+			o.compression = &compression{}
+		}
+		o.compression.minSize = minSize
+	}
+}
+
+// addVary adds value to the Vary header of h, unless it is already present.
+func addVary(h http.Header, value string) {
+	for _, v := range h[header.Vary] {
+		for _, item := range strings.Split(v, ",") {
+			item = strings.TrimSpace(item)
+			if item == "*" || strings.EqualFold(item, value) {
+				return
+			}
+		}
+	}
+	h[header.Vary] = append(h[header.Vary], value)
+}
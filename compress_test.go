@@ -0,0 +1,145 @@
+package lambada
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionNegotiate(t *testing.T) {
+	c := &compression{
+		encoders: []Encoder{GzipEncoder{}, DeflateEncoder{}},
+	}
+
+	cases := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{acceptEncoding: "", expected: ""},
+		{acceptEncoding: "gzip", expected: "gzip"},
+		{acceptEncoding: "deflate", expected: "deflate"},
+		{acceptEncoding: "gzip, deflate, br", expected: "gzip"},
+		{acceptEncoding: "gzip;q=0.5, deflate", expected: "deflate"},
+		{acceptEncoding: "GZIP;Q=0.8", expected: "gzip"},
+		{acceptEncoding: "gzip;q=0, *", expected: "deflate"},
+		{acceptEncoding: "*", expected: "gzip"},
+		{acceptEncoding: "br, identity", expected: ""},
+	}
+
+	for i, c2 := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, c2.acceptEncoding), func(t *testing.T) {
+			enc := c.negotiate(c2.acceptEncoding)
+			if c2.expected == "" {
+				assert.Nil(t, enc)
+			} else if assert.NotNil(t, enc) {
+				assert.Equal(t, c2.expected, enc.Encoding())
+			}
+		})
+	}
+}
+
+func TestIsCompressible(t *testing.T) {
+	cases := []struct {
+		contentType string
+		expected    bool
+	}{
+		{contentType: "text/html; charset=utf-8", expected: true},
+		{contentType: "application/json", expected: true},
+		{contentType: "image/svg+xml", expected: true},
+		{contentType: "image/png", expected: false},
+		{contentType: "video/mp4", expected: false},
+		{contentType: "application/zip", expected: false},
+		{contentType: "font/woff2", expected: false},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, c.contentType), func(t *testing.T) {
+			assert.Equal(t, c.expected, isCompressible(c.contentType))
+		})
+	}
+}
+
+func TestResponseWriterCompression(t *testing.T) {
+	payload := strings.Repeat(`{"hello":"world"}`, 100)
+
+	cases := []struct {
+		acceptEncoding string
+		contentType    string
+		body           string
+		encoding       string
+		binary         bool
+	}{
+		{acceptEncoding: "gzip", contentType: "application/json", body: payload, encoding: "gzip", binary: true},
+		{acceptEncoding: "deflate", contentType: "application/json", body: payload, encoding: "deflate", binary: true},
+		{acceptEncoding: "", contentType: "application/json", body: payload, encoding: "", binary: false},
+		{acceptEncoding: "gzip", contentType: "application/json", body: "{}", encoding: "", binary: false},
+		{acceptEncoding: "gzip", contentType: "image/png", body: payload, encoding: "", binary: false},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			w := newResponseWriter(Manual, false)
+			w.compression = newOptions(WithCompression()).compression
+			w.request = httptest.NewRequest(http.MethodGet, "/", nil)
+			w.request.Header.Set("Accept-Encoding", c.acceptEncoding)
+			w.Header().Set("Content-Type", c.contentType)
+			w.Write([]byte(c.body))
+			w.finalize()
+
+			assert.Equal(c.encoding, w.lockedHeader.Get("Content-Encoding"))
+			assert.Equal(c.binary, w.binary)
+			assert.Equal(fmt.Sprint(w.body.Len()), w.lockedHeader.Get("Content-Length"))
+
+			var r io.Reader = bytes.NewReader(w.Body())
+			var err error
+			switch c.encoding {
+			case "gzip":
+				r, err = gzip.NewReader(r)
+			case "deflate":
+				r, err = zlib.NewReader(r)
+			}
+			require.NoError(err)
+			data, err := io.ReadAll(r)
+			require.NoError(err)
+			assert.Equal(c.body, string(data))
+		})
+	}
+}
+
+func TestResponseWriterCompressionVary(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newResponseWriter(Manual, false)
+	w.compression = newOptions(WithCompression(), WithCompressionMinSize(0)).compression
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Vary", "Origin")
+	w.Write([]byte("Hello, World!"))
+	w.finalize()
+
+	assert.Equal([]string{"Origin", "Accept-Encoding"}, w.lockedHeader.Values("Vary"))
+	assert.Equal("", w.lockedHeader.Get("Content-Encoding"))
+}
+
+func TestResponseWriterCompressionWithoutEncoders(t *testing.T) {
+	// WithCompressionMinSize alone does not enable compression
+	w := newResponseWriter(Manual, false)
+	w.compression = newOptions(WithCompressionMinSize(0)).compression
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("Hello, World!"))
+	w.finalize()
+
+	assert.Empty(t, w.lockedHeader.Values("Vary"))
+	assert.Equal(t, "", w.lockedHeader.Get("Content-Encoding"))
+}
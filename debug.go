@@ -0,0 +1,142 @@
+package lambada
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DebugHeader is the name of the header enabling the diagnostics of a request (see WithDiagnostics), and of the
+	// response header describing how the invocation was processed.
+	DebugHeader = "X-Lambada-Debug"
+
+	// ServerTimingHeader is the name of the Server-Timing response header.
+	ServerTimingHeader = "Server-Timing"
+
+	// MaxDebugTokenLifetime is the maximum lifetime of the tokens accepted by WithDiagnostics: tokens expiring later
+	// than MaxDebugTokenLifetime from now are rejected, so that a leaked token cannot be used indefinitely.
+	MaxDebugTokenLifetime = 24 * time.Hour
+)
+
+// WithDiagnostics adds diagnostics headers to the responses of the requests carrying a valid X-Lambada-Debug header,
+// i.e. a token signed with secret (see NewDebugToken):
+//   - Server-Timing: the time spent decoding the event into an http.Request (decode), running the http.Handler
+//     (handler), finalizing and encoding the response (encode, including compression and Base64 encoding), and the
+//     whole invocation (total).
+//   - X-Lambada-Debug: the event format, the output mode, whether the response is binary and the rule which made the
+//     decision (see ResponseWriter.BinaryRule), e.g. "format=v2; output=automatic; binary=true; rule=custom:image/*".
+//
+// If secret is empty, as would be an unset environment variable, diagnostics are disabled and a warning is logged
+// using the standard log package. See WithDiagnosticsForAll to add diagnostics to all the responses.
+//
+// The timings are appended to the Server-Timing header set by the handler, if any.
+func WithDiagnostics(secret []byte) Option {
+	return func(o *options) {
+		o.diagnostics = &diagnostics{secret: secret}
+	}
+}
+
+// WithDiagnosticsForAll adds the diagnostics headers described in WithDiagnostics to all the responses, regardless of
+// the X-Lambada-Debug request header. It is intended for local development and must not be used in production, as it
+// discloses implementation details.
+func WithDiagnosticsForAll() Option {
+	return func(o *options) {
+		o.diagnostics = &diagnostics{all: true}
+	}
+}
+
+// NewDebugToken returns a token to use as the X-Lambada-Debug request header value, valid until expires.
+// The token has the form <expiration unix time>.<hex encoded HMAC-SHA256 of the expiration time>.
+// Tokens expiring later than MaxDebugTokenLifetime from the time of the request are rejected.
+func NewDebugToken(secret []byte, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + hex.EncodeToString(signDebugToken(secret, exp))
+}
+
+func signDebugToken(secret []byte, exp string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(exp))
+	return mac.Sum(nil)
+}
+
+// checkDiagnostics disables the diagnostics of o, and logs a warning, if they are enabled without a secret.
+func checkDiagnostics(o *options) {
+	if o.diagnostics != nil && !o.diagnostics.all && len(o.diagnostics.secret) == 0 {
+		log.Printf("Warning: WithDiagnostics requires a non-empty secret, diagnostics are disabled\n")
+		o.diagnostics = nil
+	}
+}
+
+// diagnostics adds the diagnostics headers to the responses.
+type diagnostics struct {
+	secret []byte
+	// all is true when diagnostics are added to all the responses
+	all bool
+}
+
+// enabled returns whether diagnostics are requested by event.
+func (d *diagnostics) enabled(event *Request) bool {
+	if d.all {
+		return true
+	}
+	exp, sig, ok := strings.Cut(strings.TrimSpace(event.header(DebugHeader)), ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	now := time.Now()
+	if err != nil || now.Unix() > expires || expires > now.Add(MaxDebugTokenLifetime).Unix() {
+		return false
+	}
+	mac, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(mac, signDebugToken(d.secret, exp))
+}
+
+// timings are the durations of the steps of an invocation.
+type timings struct {
+	decode  time.Duration
+	handler time.Duration
+	encode  time.Duration
+	total   time.Duration
+}
+
+// setHeaders sets the diagnostics headers of the response written to w, for event.
+func (d *diagnostics) setHeaders(h http.Header, event *Request, w *ResponseWriter, t timings) {
+	timing := fmt.Sprintf("decode;dur=%s, handler;dur=%s, encode;dur=%s, total;dur=%s",
+		formatMs(t.decode), formatMs(t.handler), formatMs(t.encode), formatMs(t.total))
+	// Single value headers only keep one value (e.g. for V2 events): the timings are appended to the handler's ones
+	if values := h.Values(ServerTimingHeader); len(values) > 0 {
+		timing = strings.Join(values, ", ") + ", " + timing
+	}
+	h.Set(ServerTimingHeader, timing)
+	h.Set(DebugHeader, fmt.Sprintf("format=%s; output=%s; binary=%t; rule=%s",
+		eventFormat(event), w.outputMode, w.binary, w.binaryRule))
+}
+
+// formatMs formats d as a number of milliseconds, as expected by Server-Timing.
+func formatMs(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// eventFormat returns the format of event.
+func eventFormat(event *Request) EventFormat {
+	switch {
+	case event.RequestContext.ELB != nil:
+		return EventFormatALB
+	case event.Version != "2.0":
+		return EventFormatV1
+	case strings.Contains(event.RequestContext.DomainName, ".lambda-url."):
+		return EventFormatFunctionURL
+	}
+	return EventFormatV2
+}
@@ -0,0 +1,124 @@
+package lambada
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnostics(t *testing.T) {
+	secret := []byte("secret")
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte{0x89, 'P', 'N', 'G'})
+	}), WithOutputMode(Automatic), WithBinaryMediaTypes("image/*"), WithDiagnostics(secret))
+
+	cases := []struct {
+		name    string
+		token   string
+		enabled bool
+	}{
+		{name: "valid", token: NewDebugToken(secret, time.Now().Add(time.Minute)), enabled: true},
+		{name: "missing"},
+		{name: "expired", token: NewDebugToken(secret, time.Now().Add(-time.Minute))},
+		{name: "max lifetime", token: NewDebugToken(secret, time.Now().Add(MaxDebugTokenLifetime-time.Minute)), enabled: true},
+		{name: "lifetime too long", token: NewDebugToken(secret, time.Now().Add(MaxDebugTokenLifetime+time.Minute))},
+		{name: "other secret", token: NewDebugToken([]byte("other"), time.Now().Add(time.Minute))},
+		{name: "malformed", token: "1234"},
+		{name: "invalid signature", token: "99999999999.zz"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			req := Request{Version: "2.0", RawPath: "/", Headers: map[string]string{}}
+			req.RequestContext.HTTP.Method = http.MethodGet
+			if c.token != "" {
+				req.Headers["x-lambada-debug"] = c.token
+			}
+			res, err := h(context.Background(), req)
+			require.NoError(t, err)
+			if !c.enabled {
+				assert.NotContains(res.MultiValueHeaders, ServerTimingHeader)
+				assert.NotContains(res.MultiValueHeaders, DebugHeader)
+				return
+			}
+
+			assert.Regexp(regexp.MustCompile(`^decode;dur=\d+\.\d{3}, handler;dur=\d+\.\d{3}, encode;dur=\d+\.\d{3}, total;dur=\d+\.\d{3}$`),
+				res.Headers[ServerTimingHeader])
+			assert.Equal("format=v2; output=automatic; binary=true; rule=custom:image/*", res.Headers[DebugHeader])
+		})
+	}
+}
+
+func TestDiagnosticsForAll(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add(ServerTimingHeader, "db;dur=12")
+		w.Write([]byte("Hello"))
+	}), WithDiagnosticsForAll())
+
+	res, err := h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/"})
+	require.NoError(t, err)
+	require.Len(t, res.MultiValueHeaders[ServerTimingHeader], 1)
+	assert.Regexp(regexp.MustCompile(`^db;dur=12, decode;dur=\d+\.\d{3}, handler;dur=`), res.MultiValueHeaders[ServerTimingHeader][0])
+	assert.Equal("format=v1; output=auto-content-type; binary=false; rule=default", res.Headers[DebugHeader])
+
+	// The handler's timings are kept by single value headers
+	req := Request{Version: "2.0", RawPath: "/"}
+	req.RequestContext.HTTP.Method = http.MethodGet
+	res, err = h(context.Background(), req)
+	require.NoError(t, err)
+	assert.Regexp(regexp.MustCompile(`^db;dur=12, decode;dur=\d+\.\d{3}, handler;dur=`), res.Headers[ServerTimingHeader])
+}
+
+func TestDiagnosticsWithoutSecret(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello"))
+	}), WithDiagnostics(nil))
+	assert.Contains(buf.String(), "Warning: WithDiagnostics requires a non-empty secret, diagnostics are disabled")
+
+	// Even a token signed with the empty secret is rejected
+	req := Request{HTTPMethod: http.MethodGet, Path: "/", Headers: map[string]string{
+		DebugHeader: NewDebugToken(nil, time.Now().Add(time.Minute)),
+	}}
+	res, err := h(context.Background(), req)
+	require.NoError(t, err)
+	assert.NotContains(res.MultiValueHeaders, ServerTimingHeader)
+	assert.NotContains(res.MultiValueHeaders, DebugHeader)
+}
+
+func TestEventFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(EventFormatV1, eventFormat(&Request{}))
+	assert.Equal(EventFormatALB, eventFormat(&Request{RequestContext: RequestContext{ELB: &events.ELBContext{}}}))
+	assert.Equal(EventFormatV2, eventFormat(&Request{Version: "2.0"}))
+	assert.Equal(EventFormatFunctionURL, eventFormat(&Request{
+		Version:        "2.0",
+		RequestContext: RequestContext{DomainName: "abc.lambda-url.us-east-1.on.aws"},
+	}))
+}
+
+func TestOutputModeString(t *testing.T) {
+	assert.Equal(t, "manual", Manual.String())
+	assert.Equal(t, "automatic", Automatic.String())
+	assert.Equal(t, "OutputMode(5)", OutputMode(5).String())
+}
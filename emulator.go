@@ -0,0 +1,443 @@
+package lambada
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/morelj/httptools/header"
+)
+
+// EventFormat represents the format of the Lambda events generated when emulating API Gateway.
+type EventFormat int8
+
+const (
+	// API Gateway V1 (REST API) event, using the Lambda Proxy integration
+	EventFormatV1 EventFormat = 1
+
+	// API Gateway V2 (HTTP API) event, using the 2.0 payload format
+	EventFormatV2 EventFormat = 2
+
+	// Application Load Balancer target group event
+	EventFormatALB EventFormat = 3
+
+	// Lambda Function URL event
+	EventFormatFunctionURL EventFormat = 4
+)
+
+// String returns the short name of the event format: v1, v2, alb or url.
+func (f EventFormat) String() string {
+	switch f {
+	case EventFormatV1:
+		return "v1"
+	case EventFormatV2:
+		return "v2"
+	case EventFormatALB:
+		return "alb"
+	case EventFormatFunctionURL:
+		return "url"
+	}
+	return "unknown"
+}
+
+// ParseEventFormat parses an event format short name, as returned by EventFormat.String.
+func ParseEventFormat(s string) (EventFormat, error) {
+	for _, f := range []EventFormat{EventFormatV1, EventFormatV2, EventFormatALB, EventFormatFunctionURL} {
+		if strings.EqualFold(s, f.String()) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("lambada: unknown event format %q", s)
+}
+
+const eventTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// Emulator is an http.Handler emulating API Gateway, ALB or Lambda Function URLs: incoming requests are converted into
+// Lambda events, exactly as AWS would, a Lambda handler is invoked with the event, and the returned response is
+// written back.
+//
+// The events and responses are serialized to and from JSON, so the full Lambda event path is exercised.
+type Emulator struct {
+	handler      lambda.Handler
+	format       EventFormat
+	stage        string
+	binDetectors []binDetector
+	timeout      time.Duration
+}
+
+// An EmulatorOption is used to customize an Emulator.
+type EmulatorOption func(*Emulator)
+
+// NewEmulator returns a new Emulator invoking handler with events of the given format.
+// handler is either a LambadaHandler or any handler supported by lambda.NewHandler (including lambda.Handler
+// implementations).
+func NewEmulator(handler interface{}, format EventFormat, options ...EmulatorOption) *Emulator {
+	e := &Emulator{
+		handler: lambda.NewHandler(handler),
+		format:  format,
+	}
+	for _, opt := range options {
+		opt(e)
+	}
+	return e
+}
+
+// WithEmulatorStage sets the name of the emulated API Gateway stage. The default is the $default stage.
+// This option has no effect on ALB and Function URL events.
+func WithEmulatorStage(stage string) EmulatorOption {
+	return func(e *Emulator) {
+		e.stage = stage
+	}
+}
+
+// WithEmulatorBinaryMediaTypes sets the emulated API Gateway binaryMediaTypes, using the same syntax as
+// WithBinaryMediaTypes. When set, V1 request bodies are Base64 encoded if and only if their Content-Type matches one
+// of the media types, as REST APIs do. Otherwise, bodies are Base64 encoded when they are detected to be binary.
+func WithEmulatorBinaryMediaTypes(mediaTypes ...string) EmulatorOption {
+	return func(e *Emulator) {
+		for _, mediaType := range mediaTypes {
+			e.binDetectors = append(e.binDetectors, newPatternBinDetector(mediaType, bsBinary))
+		}
+	}
+}
+
+// WithEmulatorTimeout sets the emulated Lambda function timeout, which is used as the invocation deadline.
+func WithEmulatorTimeout(timeout time.Duration) EmulatorOption {
+	return func(e *Emulator) {
+		e.timeout = timeout
+	}
+}
+
+// NewEvent converts r into a Lambda event of the given format, as AWS would, without invoking any handler.
+// Options having no effect on events (e.g. WithEmulatorTimeout) are ignored.
+func NewEvent(r *http.Request, format EventFormat, options ...EmulatorOption) (*Request, error) {
+	e := &Emulator{format: format}
+	for _, opt := range options {
+		opt(e)
+	}
+	return e.NewEvent(r)
+}
+
+// NewEvent converts r into a Lambda event, as AWS would.
+func (e *Emulator) NewEvent(r *http.Request) (*Request, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	isBase64 := e.isBase64(r.Header, body)
+
+	now := time.Now()
+	sourceIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		sourceIP = r.RemoteAddr
+	}
+	stage := e.stage
+	if stage == "" || e.format == EventFormatFunctionURL {
+		stage = "$default"
+	}
+
+	req := &Request{
+		Body:            bytesToBody(body, isBase64),
+		IsBase64Encoded: isBase64,
+	}
+
+	// The Host header is not part of r.Header
+	headers := r.Header.Clone()
+	headers.Set(header.Host, r.Host)
+
+	switch e.format {
+	case EventFormatV2, EventFormatFunctionURL:
+		req.Version = "2.0"
+		req.RouteKey = "$default"
+		req.RawPath = r.URL.Path
+		if stage != "$default" {
+			req.RawPath = "/" + stage + r.URL.Path
+		}
+		req.RawQueryString = r.URL.RawQuery
+		req.Cookies = splitCookies(headers.Values(header.Cookie))
+		headers.Del(header.Cookie)
+		req.Headers = joinHeaders(headers, true)
+		req.QueryStringParameters = joinValues(r.URL.Query())
+		req.RequestContext = e.newRequestContext(r, stage)
+		req.RequestContext.RouteKey = req.RouteKey
+		req.RequestContext.Time = now.UTC().Format(eventTimeFormat)
+		req.RequestContext.TimeEpoch = now.UnixNano() / int64(time.Millisecond)
+		req.RequestContext.HTTP.Method = r.Method
+		req.RequestContext.HTTP.Path = req.RawPath
+		req.RequestContext.HTTP.Protocol = r.Proto
+		req.RequestContext.HTTP.SourceIP = sourceIP
+		req.RequestContext.HTTP.UserAgent = r.UserAgent()
+
+	case EventFormatALB:
+		req.HTTPMethod = r.Method
+		req.Path = r.URL.Path
+		req.Headers = lastHeaders(lowerHeaders(headers))
+		if r.URL.RawQuery != "" {
+			// ALB does not decode the query parameters
+			req.QueryStringParameters = map[string]string{}
+			for _, param := range strings.Split(r.URL.RawQuery, "&") {
+				k, v, _ := strings.Cut(param, "=")
+				req.QueryStringParameters[k] = v
+			}
+		}
+		req.RequestContext.ELB = &events.ELBContext{
+			TargetGroupArn: "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/lambada/0123456789abcdef",
+		}
+
+	default:
+		req.Resource = "/{proxy+}"
+		req.Path = r.URL.Path
+		req.HTTPMethod = r.Method
+		req.MultiValueHeaders = headers
+		req.Headers = lastHeaders(headers)
+		if query := r.URL.Query(); len(query) > 0 {
+			req.MultiValueQueryStringParameters = query
+			req.QueryStringParameters = lastHeaders(query)
+		}
+		req.PathParameters = map[string]string{"proxy": strings.TrimPrefix(r.URL.Path, "/")}
+		req.RequestContext = e.newRequestContext(r, stage)
+		req.RequestContext.ResourceID = "lambada"
+		req.RequestContext.ResourcePath = req.Resource
+		req.RequestContext.HTTPMethod = r.Method
+		req.RequestContext.Protocol = r.Proto
+		req.RequestContext.RequestTime = now.UTC().Format(eventTimeFormat)
+		req.RequestContext.RequestTimeEpoch = now.UnixNano() / int64(time.Millisecond)
+		req.RequestContext.Identity.SourceIP = sourceIP
+		req.RequestContext.Identity.UserAgent = r.UserAgent()
+	}
+
+	return req, nil
+}
+
+// newRequestContext returns a RequestContext with the fields common to V1 and V2 events.
+func (e *Emulator) newRequestContext(r *http.Request, stage string) RequestContext {
+	rc := RequestContext{
+		AccountID:  "123456789012",
+		APIID:      "lambada",
+		DomainName: r.Host,
+		RequestID:  newRequestID(),
+		Stage:      stage,
+	}
+	if prefix, _, ok := strings.Cut(r.Host, "."); ok {
+		rc.DomainPrefix = prefix
+	} else {
+		rc.DomainPrefix = r.Host
+	}
+	return rc
+}
+
+// isBase64 returns whether a request body must be Base64 encoded in the event.
+func (e *Emulator) isBase64(h http.Header, body []byte) bool {
+	if len(body) == 0 {
+		return false
+	}
+
+	contentType := h.Get(header.ContentType)
+	if e.format == EventFormatV1 && e.binDetectors != nil {
+		mediaType, params := parseMediaType(contentType)
+		typ, subTyp, _ := strings.Cut(mediaType, "/")
+		status, _ := runBinDetectors(e.binDetectors, "", mediaType, typ, subTyp, params)
+		return status == bsBinary
+	}
+
+	switch isBinary(contentType, h.Get(header.ContentEncoding)) {
+	case bsBinary:
+		return true
+	case bsText:
+		return false
+	}
+	return !utf8.Valid(body)
+}
+
+// ServeHTTP converts r into a Lambda event, invokes the Lambda handler and writes the response to w.
+// Like API Gateway, an invocation error or a malformed response (e.g. an invalid Base64 body or a missing status code)
+// results in a 502 Bad Gateway response.
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	event, err := e.NewEvent(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx := lambdacontext.NewContext(r.Context(), &lambdacontext.LambdaContext{
+		AwsRequestID:       newRequestID(),
+		InvokedFunctionArn: "arn:aws:lambda:us-east-1:123456789012:function:lambada",
+	})
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	out, err := e.handler.Invoke(ctx, payload)
+	if err != nil {
+		writeGatewayError(w)
+		return
+	}
+	res, err := e.decodeResponse(out)
+	if err != nil {
+		writeGatewayError(w)
+		return
+	}
+	body, err := bodyToBytes(res.Body, res.IsBase64Encoded)
+	if err != nil || res.StatusCode < 100 || res.StatusCode > 599 {
+		writeGatewayError(w)
+		return
+	}
+	writeResponse(w, r, res, body, event.MultiValueResponse())
+}
+
+// decodeResponse decodes the Lambda response.
+// For V2 and Function URL events, a response which is not an object containing a statusCode is considered to be a
+// 200 OK JSON response, as AWS does.
+func (e *Emulator) decodeResponse(out []byte) (*Response, error) {
+	if e.format == EventFormatV2 || e.format == EventFormatFunctionURL {
+		var probe map[string]json.RawMessage
+		if err := json.Unmarshal(out, &probe); err != nil || probe["statusCode"] == nil {
+			if !json.Valid(out) {
+				return nil, errors.New("invalid Lambda response")
+			}
+			return &Response{
+				StatusCode: http.StatusOK,
+				Headers:    map[string]string{header.ContentType: "application/json"},
+				Body:       string(out),
+			}, nil
+		}
+	}
+
+	res := &Response{}
+	if err := json.Unmarshal(out, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// writeGatewayError writes the response returned by API Gateway when the Lambda invocation fails.
+func writeGatewayError(w http.ResponseWriter) {
+	w.Header().Set(header.ContentType, "application/json")
+	w.WriteHeader(http.StatusBadGateway)
+	w.Write([]byte(`{"message":"Internal server error"}`))
+}
+
+// MultiValueResponse returns whether AWS reads the MultiValueHeaders of the response to the event. This is the case
+// for V1 events, and for ALB events when multi-value headers are enabled (i.e. when the event has MultiValueHeaders).
+// Otherwise, only Headers (and Cookies for V2) are used.
+func (r *Request) MultiValueResponse() bool {
+	if r.RequestContext.ELB != nil {
+		return r.MultiValueHeaders != nil
+	}
+	return r.Version != "2.0"
+}
+
+// writeResponse writes the Lambda response res to w, with its decoded body. r is the emulated request.
+// MultiValueHeaders are only used if multiValue is true.
+func writeResponse(w http.ResponseWriter, r *http.Request, res *Response, body []byte, multiValue bool) {
+	h := w.Header()
+	for k, v := range res.Headers {
+		h.Set(k, v)
+	}
+	if multiValue {
+		for k, v := range res.MultiValueHeaders {
+			h[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+	for _, cookie := range res.Cookies {
+		h.Add(header.SetCookie, cookie)
+	}
+	// The body is already complete. The Content-Length of HEAD responses, when set, is the one of the GET response.
+	h.Del(header.TransferEncoding)
+	if h.Get(header.ContentLength) == "" && r.Method != http.MethodHead && bodyAllowedForStatus(res.StatusCode) {
+		h.Set(header.ContentLength, strconv.Itoa(len(body)))
+	}
+
+	w.WriteHeader(res.StatusCode)
+	w.Write(body)
+}
+
+// newRequestID returns a random request ID, formatted as an UUID.
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	s := hex.EncodeToString(b[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// splitCookies splits the values of Cookie headers into individual cookies.
+func splitCookies(values []string) []string {
+	var res []string
+	for _, v := range values {
+		for _, cookie := range strings.Split(v, ";") {
+			if cookie = strings.TrimSpace(cookie); cookie != "" {
+				res = append(res, cookie)
+			}
+		}
+	}
+	return res
+}
+
+// joinHeaders converts h to single value headers, multiple values being joined with commas.
+// If lower is true, the keys are lower-cased.
+func joinHeaders(h http.Header, lower bool) map[string]string {
+	res := make(map[string]string, len(h))
+	for k, v := range h {
+		if lower {
+			k = strings.ToLower(k)
+		}
+		res[k] = strings.Join(v, ",")
+	}
+	return res
+}
+
+// joinValues converts v to a single value map, multiple values being joined with commas.
+func joinValues(v map[string][]string) map[string]string {
+	if len(v) == 0 {
+		return nil
+	}
+	res := make(map[string]string, len(v))
+	for k, vv := range v {
+		res[k] = strings.Join(vv, ",")
+	}
+	return res
+}
+
+// lastHeaders converts h to single value headers, retaining only the last value of each key.
+func lastHeaders(h map[string][]string) map[string]string {
+	res := make(map[string]string, len(h))
+	for k, v := range h {
+		if len(v) > 0 {
+			res[k] = v[len(v)-1]
+		}
+	}
+	return res
+}
+
+// lowerHeaders returns a copy of h with lower-cased keys.
+func lowerHeaders(h http.Header) map[string][]string {
+	res := make(map[string][]string, len(h))
+	for k, v := range h {
+		res[strings.ToLower(k)] = v
+	}
+	return res
+}
@@ -0,0 +1,257 @@
+package lambada
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmulatorNewEvent(t *testing.T) {
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "http://example.com/items?a=1&a=2&b=x%20y", strings.NewReader("Hello"))
+		r.Header.Set("Content-Type", "text/plain")
+		r.Header.Add("X-Multi", "1")
+		r.Header.Add("X-Multi", "2")
+		r.Header.Set("Cookie", "c1=v1; c2=v2")
+		return r
+	}
+
+	t.Run("v1", func(t *testing.T) {
+		assert := assert.New(t)
+		req, err := NewEvent(newRequest(), EventFormatV1, WithEmulatorStage("prod"))
+		assert.NoError(err)
+		assert.Equal("", req.Version)
+		assert.Equal(http.MethodPost, req.HTTPMethod)
+		assert.Equal("/items", req.Path)
+		assert.Equal([]string{"1", "2"}, req.MultiValueHeaders["X-Multi"])
+		assert.Equal("2", req.Headers["X-Multi"])
+		assert.Equal([]string{"1", "2"}, req.MultiValueQueryStringParameters["a"])
+		assert.Equal("x y", req.QueryStringParameters["b"])
+		assert.Equal("prod", req.RequestContext.Stage)
+		assert.NotEmpty(req.RequestContext.RequestID)
+		assert.NotZero(req.RequestContext.RequestTimeEpoch)
+		assert.Equal("Hello", req.Body)
+		assert.False(req.IsBase64Encoded)
+	})
+
+	t.Run("v2", func(t *testing.T) {
+		assert := assert.New(t)
+		req, err := NewEvent(newRequest(), EventFormatV2, WithEmulatorStage("prod"))
+		assert.NoError(err)
+		assert.Equal("2.0", req.Version)
+		assert.Equal("/prod/items", req.RawPath)
+		assert.Equal("a=1&a=2&b=x%20y", req.RawQueryString)
+		assert.Equal("1,2", req.QueryStringParameters["a"])
+		assert.Equal("1,2", req.Headers["x-multi"])
+		assert.Equal([]string{"c1=v1", "c2=v2"}, req.Cookies)
+		assert.Equal("", req.Headers["cookie"])
+		assert.Equal(http.MethodPost, req.RequestContext.HTTP.Method)
+		assert.NotZero(req.RequestContext.TimeEpoch)
+	})
+
+	t.Run("url", func(t *testing.T) {
+		assert := assert.New(t)
+		req, err := NewEvent(newRequest(), EventFormatFunctionURL, WithEmulatorStage("prod"))
+		assert.NoError(err)
+		assert.Equal("/items", req.RawPath)
+		assert.Equal("$default", req.RequestContext.Stage)
+	})
+
+	t.Run("alb", func(t *testing.T) {
+		assert := assert.New(t)
+		req, err := NewEvent(newRequest(), EventFormatALB)
+		assert.NoError(err)
+		assert.Equal("2", req.Headers["x-multi"])
+		assert.Equal("x%20y", req.QueryStringParameters["b"])
+		assert.NotNil(req.RequestContext.ELB)
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		assert := assert.New(t)
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("\x00\x01"))
+		r.Header.Set("Content-Type", "image/png")
+		req, err := NewEvent(r, EventFormatV2)
+		assert.NoError(err)
+		assert.True(req.IsBase64Encoded)
+		assert.Equal("AAE=", req.Body)
+
+		r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("\x00\x01"))
+		r.Header.Set("Content-Type", "image/png")
+		req, err = NewEvent(r, EventFormatV1, WithEmulatorBinaryMediaTypes("application/pdf"))
+		assert.NoError(err)
+		assert.False(req.IsBase64Encoded)
+	})
+}
+
+func TestEmulator(t *testing.T) {
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		http.SetCookie(w, &http.Cookie{Name: "a", Value: "1"})
+		http.SetCookie(w, &http.Cookie{Name: "b", Value: "2"})
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}), WithOutputMode(Automatic))
+
+	for _, format := range []EventFormat{EventFormatV1, EventFormatV2, EventFormatALB, EventFormatFunctionURL} {
+		t.Run(format.String(), func(t *testing.T) {
+			assert := assert.New(t)
+
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("\x00\x01\xff"))
+			r.Header.Set("Content-Type", "application/octet-stream")
+			rec := httptest.NewRecorder()
+			NewEmulator(h, format).ServeHTTP(rec, r)
+
+			assert.Equal(http.StatusCreated, rec.Code)
+			assert.Equal("\x00\x01\xff", rec.Body.String())
+			if format == EventFormatALB {
+				// Single-value headers only
+				assert.Equal([]string{"a=1"}, rec.Header().Values("Set-Cookie"))
+			} else {
+				assert.Equal([]string{"a=1", "b=2"}, rec.Header().Values("Set-Cookie"))
+			}
+		})
+	}
+}
+
+func TestEmulatorMultiValueHeaders(t *testing.T) {
+	// A handler only setting MultiValueHeaders, which are ignored by API Gateway V2, Function URLs and ALB (unless
+	// multi-value headers are enabled)
+	handler := func(ctx context.Context, event Request) (Response, error) {
+		return Response{
+			StatusCode:        http.StatusOK,
+			MultiValueHeaders: map[string][]string{"X-Multi": {"1", "2"}},
+		}, nil
+	}
+
+	cases := map[EventFormat][]string{
+		EventFormatV1:          {"1", "2"},
+		EventFormatV2:          nil,
+		EventFormatALB:         nil,
+		EventFormatFunctionURL: nil,
+	}
+	for format, expected := range cases {
+		t.Run(format.String(), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			NewEmulator(handler, format).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, expected, rec.Header().Values("X-Multi"))
+		})
+	}
+}
+
+func TestEmulatorAnyHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Inferred response format
+	var deadline time.Time
+	var requestID string
+	handler := func(ctx context.Context, event map[string]interface{}) (map[string]string, error) {
+		deadline, _ = ctx.Deadline()
+		if lc, ok := lambdacontext.FromContext(ctx); ok {
+			requestID = lc.AwsRequestID
+		}
+		return map[string]string{"path": event["rawPath"].(string)}, nil
+	}
+	rec := httptest.NewRecorder()
+	NewEmulator(handler, EventFormatFunctionURL, WithEmulatorTimeout(time.Minute)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(`{"path":"/hello"}`, rec.Body.String())
+	assert.False(deadline.IsZero())
+	assert.NotEmpty(requestID)
+
+	// Errors
+	failing := func(ctx context.Context, event map[string]interface{}) (Response, error) {
+		return Response{}, errors.New("failure")
+	}
+	rec = httptest.NewRecorder()
+	NewEmulator(failing, EventFormatV1).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(http.StatusBadGateway, rec.Code)
+	assert.JSONEq(`{"message":"Internal server error"}`, rec.Body.String())
+}
+
+func TestEmulatorInvalidResponse(t *testing.T) {
+	cases := []struct {
+		name     string
+		format   EventFormat
+		response map[string]interface{}
+	}{
+		{name: "invalid base64", format: EventFormatV1, response: map[string]interface{}{
+			"statusCode": 200, "body": "not base64!", "isBase64Encoded": true}},
+		{name: "missing v1 status", format: EventFormatV1, response: map[string]interface{}{"body": "Hello"}},
+		{name: "missing alb status", format: EventFormatALB, response: map[string]interface{}{"body": "Hello"}},
+		{name: "invalid status", format: EventFormatV2, response: map[string]interface{}{"statusCode": 42}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			handler := func(ctx context.Context, event map[string]interface{}) (map[string]interface{}, error) {
+				return c.response, nil
+			}
+			rec := httptest.NewRecorder()
+			NewEmulator(handler, c.format).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, http.StatusBadGateway, rec.Code)
+			assert.JSONEq(t, `{"message":"Internal server error"}`, rec.Body.String())
+		})
+	}
+}
+
+func TestEmulatorContentLength(t *testing.T) {
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("Hello"))
+	}))
+
+	cases := []struct {
+		method        string
+		ifNoneMatch   string
+		status        int
+		contentLength string
+	}{
+		{method: http.MethodGet, status: http.StatusOK, contentLength: "5"},
+		// The Content-Length of the GET response is kept
+		{method: http.MethodHead, status: http.StatusOK, contentLength: "5"},
+		{method: http.MethodGet, ifNoneMatch: `"abc"`, status: http.StatusNotModified},
+	}
+
+	for _, c := range cases {
+		t.Run(c.method+c.ifNoneMatch, func(t *testing.T) {
+			assert := assert.New(t)
+
+			r := httptest.NewRequest(c.method, "/", nil)
+			if c.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", c.ifNoneMatch)
+			}
+			rec := httptest.NewRecorder()
+			NewEmulator(h, EventFormatV2).ServeHTTP(rec, r)
+			assert.Equal(c.status, rec.Code)
+			assert.Equal(c.contentLength, rec.Header().Get("Content-Length"))
+			assert.Empty(rec.Header().Values("Transfer-Encoding"))
+		})
+	}
+}
+
+func TestParseEventFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, format := range []EventFormat{EventFormatV1, EventFormatV2, EventFormatALB, EventFormatFunctionURL} {
+		parsed, err := ParseEventFormat(format.String())
+		assert.NoError(err)
+		assert.Equal(format, parsed)
+	}
+	_, err := ParseEventFormat("v3")
+	assert.Error(err)
+}
@@ -0,0 +1,111 @@
+package lambada
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/morelj/httptools/header"
+)
+
+// WithETag enables automatic ETag generation and conditional requests handling.
+//
+// Successful (2xx) responses to GET and HEAD requests which do not already have an ETag header get a strong ETag
+// computed by hashing the response body. As with net/http, handlers should write the body of HEAD responses (it is
+// discarded): HEAD responses without body do not get an ETag, as it would not match the one of the GET response.
+// When the response is compressed (see WithCompression), the ETag is made weak, as it is computed prior compression.
+// Then, the If-None-Match and If-Modified-Since request headers are evaluated against the ETag and Last-Modified
+// response headers, and a 304 Not Modified response without body is returned when they match.
+func WithETag() Option {
+	return func(o *options) {
+		o.etag = true
+	}
+}
+
+// setETag sets a strong ETag computed from the body on w, if eligible.
+func (w *ResponseWriter) setETag() {
+	if !w.isConditionalCandidate() || w.lockedHeader.Get(header.ETag) != "" {
+		return
+	}
+	if w.requestMethod() == http.MethodHead && w.body.Len() == 0 {
+		return
+	}
+
+	sum := sha256.Sum256(w.body.Bytes())
+	w.lockedHeader.Set(header.ETag, `"`+base64.RawURLEncoding.EncodeToString(sum[:])+`"`)
+}
+
+// weakenETag turns the strong ETag of h, if any, into a weak one. This is required when the content coding of the body
+// changes, as strong ETags identify the exact bytes of the representation.
+func weakenETag(h http.Header) {
+	if etag := h.Get(header.ETag); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set(header.ETag, "W/"+etag)
+	}
+}
+
+// checkPreconditions evaluates the If-None-Match and If-Modified-Since request headers and turns the response into a
+// 304 Not Modified response if the client's representation is up to date.
+func (w *ResponseWriter) checkPreconditions() {
+	if !w.isConditionalCandidate() || !w.notModified() {
+		return
+	}
+
+	w.statusCode = http.StatusNotModified
+	w.body.Reset()
+
+	// Same as net/http: Headers describing the (now absent) content are removed
+	delete(w.lockedHeader, header.ContentType)
+	delete(w.lockedHeader, header.ContentLength)
+	delete(w.lockedHeader, header.ContentEncoding)
+	if w.lockedHeader.Get(header.ETag) != "" {
+		delete(w.lockedHeader, header.LastModified)
+	}
+}
+
+// isConditionalCandidate returns whether the response is eligible to ETag generation and conditional requests.
+func (w *ResponseWriter) isConditionalCandidate() bool {
+	method := w.requestMethod()
+	return (method == http.MethodGet || method == http.MethodHead) && w.statusCode >= 200 && w.statusCode <= 299
+}
+
+// notModified returns whether the conditional request headers indicate that the client's representation is up to
+// date.
+// As mandated by RFC 9110, If-Modified-Since is ignored when If-None-Match is present.
+func (w *ResponseWriter) notModified() bool {
+	if inm := w.requestHeader(header.IfNoneMatch); inm != "" {
+		return etagMatches(inm, w.lockedHeader.Get(header.ETag))
+	}
+
+	ims := w.requestHeader(header.IfModifiedSince)
+	lastModified := w.lockedHeader.Get(header.LastModified)
+	if ims == "" || lastModified == "" {
+		return false
+	}
+	imsTime, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	lastModifiedTime, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !lastModifiedTime.Truncate(time.Second).After(imsTime)
+}
+
+// etagMatches returns whether etag matches any of the entity tags listed in the value of an If-None-Match header,
+// using the weak comparison function.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package lambada
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEtagMatches(t *testing.T) {
+	cases := []struct {
+		ifNoneMatch string
+		etag        string
+		expected    bool
+	}{
+		{ifNoneMatch: `"abc"`, etag: `"abc"`, expected: true},
+		{ifNoneMatch: `"xyz", "abc"`, etag: `"abc"`, expected: true},
+		{ifNoneMatch: `W/"abc"`, etag: `"abc"`, expected: true},
+		{ifNoneMatch: `"abc"`, etag: `W/"abc"`, expected: true},
+		{ifNoneMatch: `*`, etag: `"abc"`, expected: true},
+		{ifNoneMatch: `*`, etag: ``, expected: false},
+		{ifNoneMatch: `"xyz"`, etag: `"abc"`, expected: false},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			assert.Equal(t, c.expected, etagMatches(c.ifNoneMatch, c.etag))
+		})
+	}
+}
+
+func TestResponseWriterETag(t *testing.T) {
+	newWriter := func(method string, reqHeader map[string]string) *ResponseWriter {
+		w := newResponseWriter(AutoContentType, false)
+		w.etag = true
+		w.request = httptest.NewRequest(method, "/", nil)
+		for k, v := range reqHeader {
+			w.request.Header.Set(k, v)
+		}
+		return w
+	}
+
+	// Compute the ETag of the body
+	w := newWriter(http.MethodGet, nil)
+	w.Write([]byte("Hello, World!"))
+	w.finalize()
+	etag := w.lockedHeader.Get("ETag")
+
+	cases := []struct {
+		method     string
+		reqHeader  map[string]string
+		resHeader  map[string]string
+		statusCode int
+		expected   int
+		etag       string
+	}{
+		{method: http.MethodGet, expected: http.StatusOK, etag: etag},
+		{method: http.MethodHead, expected: http.StatusOK, etag: etag},
+		{method: http.MethodHead, reqHeader: map[string]string{"If-None-Match": etag}, expected: http.StatusNotModified, etag: etag},
+		{method: http.MethodPost, expected: http.StatusOK, etag: ""},
+		{method: http.MethodGet, statusCode: http.StatusNotFound, expected: http.StatusNotFound, etag: ""},
+		{method: http.MethodGet, reqHeader: map[string]string{"If-None-Match": etag}, expected: http.StatusNotModified, etag: etag},
+		{method: http.MethodGet, reqHeader: map[string]string{"If-None-Match": `"other"`}, expected: http.StatusOK, etag: etag},
+		{method: http.MethodPost, reqHeader: map[string]string{"If-None-Match": etag}, expected: http.StatusOK, etag: ""},
+		{
+			method:    http.MethodGet,
+			reqHeader: map[string]string{"If-None-Match": `"custom"`},
+			resHeader: map[string]string{"ETag": `"custom"`},
+			expected:  http.StatusNotModified,
+			etag:      `"custom"`,
+		},
+		{
+			method:    http.MethodGet,
+			reqHeader: map[string]string{"If-Modified-Since": "Mon, 02 Jan 2006 15:04:05 GMT"},
+			resHeader: map[string]string{"Last-Modified": "Mon, 02 Jan 2006 15:04:05 GMT"},
+			expected:  http.StatusNotModified,
+			etag:      etag,
+		},
+		{
+			method:    http.MethodGet,
+			reqHeader: map[string]string{"If-Modified-Since": "Mon, 02 Jan 2006 15:04:05 GMT"},
+			resHeader: map[string]string{"Last-Modified": "Tue, 03 Jan 2006 15:04:05 GMT"},
+			expected:  http.StatusOK,
+			etag:      etag,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, c.method), func(t *testing.T) {
+			assert := assert.New(t)
+
+			w := newWriter(c.method, c.reqHeader)
+			for k, v := range c.resHeader {
+				w.Header().Set(k, v)
+			}
+			if c.statusCode != 0 {
+				w.WriteHeader(c.statusCode)
+			}
+			w.Write([]byte("Hello, World!"))
+			w.finalize()
+
+			assert.Equal(c.expected, w.statusCode)
+			assert.Equal(c.etag, w.lockedHeader.Get("ETag"))
+			if c.expected == http.StatusNotModified {
+				assert.Empty(w.Body())
+				assert.Equal("", w.lockedHeader.Get("Content-Length"))
+				assert.Equal("", w.lockedHeader.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestResponseWriterETagHeadWithoutBody(t *testing.T) {
+	w := newResponseWriter(AutoContentType, false)
+	w.etag = true
+	w.request = httptest.NewRequest(http.MethodHead, "/", nil)
+	w.finalize()
+	assert.Equal(t, "", w.lockedHeader.Get("ETag"))
+}
+
+func TestResponseWriterETagCompression(t *testing.T) {
+	assert := assert.New(t)
+
+	body := strings.Repeat("Hello, World! ", 100)
+	newWriter := func(ifNoneMatch string) *ResponseWriter {
+		w := newResponseWriter(AutoContentType, false)
+		w.etag = true
+		w.compression = newOptions(WithCompression()).compression
+		w.request = httptest.NewRequest(http.MethodGet, "/", nil)
+		w.request.Header.Set("Accept-Encoding", "gzip")
+		if ifNoneMatch != "" {
+			w.request.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(body))
+		w.finalize()
+		return w
+	}
+
+	w := newWriter("")
+	assert.Equal("gzip", w.lockedHeader.Get("Content-Encoding"))
+	etag := w.lockedHeader.Get("ETag")
+	assert.True(strings.HasPrefix(etag, `W/"`), etag)
+
+	// The 304 response is not compressed
+	w = newWriter(etag)
+	assert.Equal(http.StatusNotModified, w.statusCode)
+	assert.Equal("", w.lockedHeader.Get("Content-Encoding"))
+	assert.Empty(w.Body())
+}
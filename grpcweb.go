@@ -0,0 +1,272 @@
+package lambada
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/morelj/httptools/header"
+)
+
+// rpcProtocol represents the RPC protocol used by a request, when gRPC-Web and Connect support is enabled.
+type rpcProtocol int8
+
+const (
+	rpcNone rpcProtocol = iota
+	rpcGRPCWeb
+	rpcGRPCWebText
+	rpcConnect
+)
+
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+)
+
+// WithGRPCWeb enables gRPC-Web and Connect protocols support.
+//
+// For gRPC-Web requests (application/grpc-web, application/grpc-web+proto, ...):
+//   - The requests bodies using the text variant (application/grpc-web-text) are decoded from Base64, and the request
+//     is passed to the http.Handler using the binary variant. The response is then encoded back to Base64 using the
+//     text variant.
+//   - Responses are sent in binary mode (except for the text variant).
+//   - Trailers are written to the response body as a gRPC-Web trailer frame, regardless of the trailer mode. If the
+//     handler already wrote a trailer frame (e.g. when it is itself a gRPC-Web server), the body is left untouched.
+//   - For trailers-only responses (i.e. without messages, which is usually the case for errors), the trailers are
+//     sent as headers. The HTTP status is left untouched, as gRPC-Web clients expect the status in grpc-status.
+//   - For other responses, a non-zero grpc-status in the trailer frame is mapped to the corresponding HTTP status
+//     (see GRPCStatusToHTTP), unless the handler set a status other than 200 OK. This way, API Gateway logs and
+//     metrics reflect the errors.
+//
+// For Connect requests (having a Connect-Protocol-Version header, or using an application/connect+ content type):
+//   - Streaming responses (application/connect+proto, application/connect+json, ...) are made of binary frames
+//     whatever the codec, and are sent in binary mode, as are application/proto unary responses, regardless of the
+//     output mode.
+//   - Unary error responses (a JSON object made of a Connect error code, and optionally a message and details) sent
+//     with a 200 OK status get the HTTP status corresponding to the error code, as defined by the Connect protocol.
+func WithGRPCWeb() Option {
+	return func(o *options) {
+		o.grpcWeb = true
+	}
+}
+
+// GRPCStatusToHTTP returns the HTTP status code corresponding to the given gRPC status code.
+// Unknown codes are mapped to 500 Internal Server Error.
+func GRPCStatusToHTTP(code int) int {
+	switch code {
+	case 0: // OK
+		return http.StatusOK
+	case 1: // Canceled
+		return 499
+	case 3, 9, 11: // InvalidArgument, FailedPrecondition, OutOfRange
+		return http.StatusBadRequest
+	case 4: // DeadlineExceeded
+		return http.StatusGatewayTimeout
+	case 5: // NotFound
+		return http.StatusNotFound
+	case 6, 10: // AlreadyExists, Aborted
+		return http.StatusConflict
+	case 7: // PermissionDenied
+		return http.StatusForbidden
+	case 8: // ResourceExhausted
+		return http.StatusTooManyRequests
+	case 12: // Unimplemented
+		return http.StatusNotImplemented
+	case 14: // Unavailable
+		return http.StatusServiceUnavailable
+	case 16: // Unauthenticated
+		return http.StatusUnauthorized
+	}
+	// Unknown, Internal, DataLoss
+	return http.StatusInternalServerError
+}
+
+// connectCodes are the gRPC status codes of the Connect error codes.
+var connectCodes = map[string]int{
+	"canceled":            1,
+	"unknown":             2,
+	"invalid_argument":    3,
+	"deadline_exceeded":   4,
+	"not_found":           5,
+	"already_exists":      6,
+	"permission_denied":   7,
+	"resource_exhausted":  8,
+	"failed_precondition": 9,
+	"aborted":             10,
+	"out_of_range":        11,
+	"unimplemented":       12,
+	"internal":            13,
+	"unavailable":         14,
+	"data_loss":           15,
+	"unauthenticated":     16,
+}
+
+// detectRPCProtocol returns the RPC protocol used by r.
+func detectRPCProtocol(r *http.Request) rpcProtocol {
+	mediaType, _ := parseMediaType(r.Header.Get(header.ContentType))
+	switch {
+	case strings.HasPrefix(mediaType, grpcWebTextContentType):
+		return rpcGRPCWebText
+	case strings.HasPrefix(mediaType, grpcWebContentType):
+		return rpcGRPCWeb
+	case strings.HasPrefix(mediaType, "application/connect+") || r.Header.Get("Connect-Protocol-Version") != "":
+		return rpcConnect
+	}
+	return rpcNone
+}
+
+// prepareGRPCWebTextRequest decodes the Base64 body of a gRPC-Web text request, and switches its content type to the
+// binary variant.
+func prepareGRPCWebTextRequest(r *http.Request) error {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	body, err := decodeGRPCWebText(data)
+	if err != nil {
+		return err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Del(header.ContentLength)
+	r.Header.Set(header.ContentType, grpcWebContentType+strings.TrimPrefix(r.Header.Get(header.ContentType), grpcWebTextContentType))
+	return nil
+}
+
+// decodeGRPCWebText decodes a gRPC-Web text body.
+// As each message may be encoded separately, the body may be a concatenation of padded Base64 strings.
+func decodeGRPCWebText(data []byte) ([]byte, error) {
+	var res []byte
+	for len(data) > 0 {
+		// Find the end of the current Base64 chunk, i.e. the end of its padding
+		end := bytes.IndexByte(data, '=')
+		if end < 0 {
+			end = len(data)
+		} else {
+			for end < len(data) && data[end] == '=' {
+				end++
+			}
+		}
+
+		chunk := make([]byte, base64.StdEncoding.DecodedLen(end))
+		n, err := base64.StdEncoding.Decode(chunk, data[:end])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, chunk[:n]...)
+		data = data[end:]
+	}
+	return res, nil
+}
+
+// finalizeRPC finalizes gRPC-Web and Connect responses.
+// This replaces the standard trailers delivery.
+func (w *ResponseWriter) finalizeRPC() {
+	if w.rpcProtocol == rpcConnect {
+		w.deliverTrailers()
+		mediaType, _ := parseMediaType(w.lockedHeader.Get(header.ContentType))
+		switch {
+		case mediaType == "application/proto" || strings.HasPrefix(mediaType, "application/connect+"):
+			w.SetBinary(true)
+		case mediaType == "application/json" && w.statusCode == http.StatusOK:
+			if code, ok := connectErrorCode(w.body.Bytes()); ok {
+				w.statusCode = GRPCStatusToHTTP(code)
+			}
+		}
+		return
+	}
+
+	_, hasTrailerFrame := grpcWebTrailerFrame(w.body.Bytes())
+	trailersOnly := w.body.Len() == 0
+	switch {
+	case trailersOnly:
+		// Trailers-only response: trailers are sent as headers
+		w.trailerMode = MergeTrailers
+	case hasTrailerFrame:
+		// The trailers have already been written by the handler
+		w.trailerMode = DropTrailers
+	default:
+		w.trailerMode = BodyTrailers
+		w.trailerEncoder = GRPCWebTrailerEncoder{}
+	}
+	w.deliverTrailers()
+
+	if !trailersOnly && w.statusCode == http.StatusOK {
+		if code, ok := grpcWebStatus(w.body.Bytes()); ok && code != 0 {
+			w.statusCode = GRPCStatusToHTTP(code)
+		}
+	}
+
+	if w.rpcProtocol == rpcGRPCWebText {
+		encoded := base64.StdEncoding.EncodeToString(w.body.Bytes())
+		w.body.Reset()
+		w.body.WriteString(encoded)
+		if contentType := w.lockedHeader.Get(header.ContentType); strings.HasPrefix(contentType, grpcWebContentType) {
+			w.lockedHeader.Set(header.ContentType, grpcWebTextContentType+strings.TrimPrefix(contentType, grpcWebContentType))
+		}
+		w.SetBinary(false)
+	} else {
+		w.SetBinary(true)
+	}
+}
+
+// grpcWebTrailerFrame returns the payload of the trailer frame contained in data, a sequence of gRPC-Web frames.
+// The payload may be truncated if data is.
+func grpcWebTrailerFrame(data []byte) ([]byte, bool) {
+	for len(data) >= 5 {
+		length := binary.BigEndian.Uint32(data[1:5])
+		if data[0]&0x80 != 0 {
+			if uint64(len(data)-5) < uint64(length) {
+				return data[5:], true
+			}
+			return data[5 : 5+length], true
+		}
+		if uint64(len(data)-5) < uint64(length) {
+			return nil, false
+		}
+		data = data[5+length:]
+	}
+	return nil, false
+}
+
+// grpcWebStatus returns the grpc-status held by the trailer frame contained in data, a sequence of gRPC-Web frames.
+func grpcWebStatus(data []byte) (int, bool) {
+	trailers, ok := grpcWebTrailerFrame(data)
+	if !ok {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(trailers), "\r\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(k), "grpc-status") {
+			code, err := strconv.Atoi(strings.TrimSpace(v))
+			return code, err == nil
+		}
+	}
+	return 0, false
+}
+
+// connectErrorCode returns the gRPC status code of the Connect unary error held by body, i.e. a JSON object made of a
+// known error code, and optionally a message and details.
+func connectErrorCode(body []byte) (int, bool) {
+	var e map[string]json.RawMessage
+	if err := json.Unmarshal(body, &e); err != nil {
+		return 0, false
+	}
+	for k := range e {
+		if k != "code" && k != "message" && k != "details" {
+			return 0, false
+		}
+	}
+	var name string
+	if err := json.Unmarshal(e["code"], &name); err != nil {
+		return 0, false
+	}
+	code, ok := connectCodes[name]
+	return code, ok
+}
@@ -0,0 +1,312 @@
+package lambada
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// grpcWebFrame encodes a gRPC-Web frame
+func grpcWebFrame(flag byte, payload []byte) []byte {
+	frame := make([]byte, 5, 5+len(payload))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+// readGRPCWebFrames decodes the gRPC-Web frames contained in data
+func readGRPCWebFrames(t *testing.T, data []byte) ([][]byte, http.Header) {
+	var messages [][]byte
+	var trailers http.Header
+	for len(data) > 0 {
+		require.GreaterOrEqual(t, len(data), 5)
+		flag := data[0]
+		length := int(binary.BigEndian.Uint32(data[1:5]))
+		require.GreaterOrEqual(t, len(data), 5+length)
+		payload := data[5 : 5+length]
+		data = data[5+length:]
+
+		if flag&0x80 == 0 {
+			messages = append(messages, payload)
+			continue
+		}
+		mime, err := textproto.NewReader(bufio.NewReader(io.MultiReader(bytes.NewReader(payload), strings.NewReader("\r\n")))).ReadMIMEHeader()
+		require.NoError(t, err)
+		trailers = http.Header(mime)
+	}
+	return messages, trailers
+}
+
+type grpcWebResult struct {
+	statusCode int
+	header     http.Header
+	messages   [][]byte
+	trailers   http.Header
+}
+
+// invokeGRPCWeb is an in-process gRPC-Web client, sending a single message to h through an API Gateway V2 event
+func invokeGRPCWeb(t *testing.T, h LambadaHandler, path string, contentType string, message []byte) grpcWebResult {
+	body := grpcWebFrame(0, message)
+	if strings.HasPrefix(contentType, grpcWebTextContentType) {
+		body = []byte(base64.StdEncoding.EncodeToString(body))
+	}
+
+	req := Request{
+		Version:         "2.0",
+		RawPath:         path,
+		Headers:         map[string]string{"content-type": contentType, "x-grpc-web": "1"},
+		Body:            base64.StdEncoding.EncodeToString(body),
+		IsBase64Encoded: true,
+	}
+	req.RequestContext.HTTP.Method = http.MethodPost
+
+	res, err := h(context.Background(), req)
+	require.NoError(t, err)
+
+	data, err := bodyToBytes(res.Body, res.IsBase64Encoded)
+	require.NoError(t, err)
+	if strings.HasPrefix(res.Headers["Content-Type"], grpcWebTextContentType) {
+		data, err = decodeGRPCWebText(data)
+		require.NoError(t, err)
+	}
+
+	result := grpcWebResult{
+		statusCode: res.StatusCode,
+		header:     http.Header(res.MultiValueHeaders),
+	}
+	result.messages, result.trailers = readGRPCWebFrames(t, data)
+	return result
+}
+
+// healthHandler returns a minimal gRPC-Web implementation of the grpc.health.v1.Health/Check method, writing the
+// trailer frame by itself, as gRPC-Web servers do. Only the "lambada" service is known.
+func healthHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		// Text requests are decoded by Lambada
+		assert.False(t, strings.HasPrefix(r.Header.Get("Content-Type"), grpcWebTextContentType))
+		messages, _ := readGRPCWebFrames(t, body)
+
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		// HealthCheckRequest{Service: "lambada"}
+		if len(messages) != 1 || !bytes.Equal(messages[0], []byte{0x0a, 0x07, 'l', 'a', 'm', 'b', 'a', 'd', 'a'}) {
+			// Trailers-only response
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "unknown service")
+			return
+		}
+
+		// HealthCheckResponse{Status: SERVING}
+		w.Write(grpcWebFrame(0, []byte{0x08, 0x01}))
+		w.Write(grpcWebFrame(0x80, []byte("grpc-status: 0\r\n")))
+	})
+}
+
+// TestGRPCWeb runs a gRPC health service writing the trailer frame by itself.
+func TestGRPCWeb(t *testing.T) {
+	h := NewHandler(healthHandler(t), WithGRPCWeb())
+
+	for _, contentType := range []string{"application/grpc-web+proto", "application/grpc-web-text+proto", "application/grpc-web-text"} {
+		t.Run(contentType, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			check := func(service string) grpcWebResult {
+				req := append([]byte{0x0a, byte(len(service))}, service...)
+				return invokeGRPCWeb(t, h, "/grpc.health.v1.Health/Check", contentType, req)
+			}
+
+			res := check("lambada")
+			assert.Equal(http.StatusOK, res.statusCode)
+			assert.True(strings.HasPrefix(res.header.Get("Content-Type"), strings.TrimSuffix(contentType, "+proto")))
+			require.Len(res.messages, 1)
+			assert.Equal([]byte{0x08, 0x01}, res.messages[0])
+			assert.Equal("0", res.trailers.Get("Grpc-Status"))
+			assert.Equal("", res.header.Get("Grpc-Status"))
+
+			// Trailers-only response
+			res = check("missing")
+			assert.Equal(http.StatusOK, res.statusCode)
+			assert.Empty(res.messages)
+			assert.Equal("5", res.header.Get("Grpc-Status"))
+			assert.Equal("unknown service", res.header.Get("Grpc-Message"))
+		})
+	}
+}
+
+func TestGRPCWebTrailers(t *testing.T) {
+	message := grpcWebFrame(0, []byte("hello"))
+	trailerFrame := grpcWebFrame(0x80, []byte("grpc-status: 0\r\n"))
+	complete := append(append([]byte{}, message...), trailerFrame...)
+
+	cases := []struct {
+		name     string
+		body     []byte
+		trailers bool
+		expected []byte
+	}{
+		{name: "trailers", body: message, trailers: true, expected: complete},
+		{name: "trailer frame", body: complete, expected: complete},
+		{name: "trailer frame and trailers", body: complete, trailers: true, expected: complete},
+		{name: "malformed frame", body: message[:6], trailers: true, expected: append(append([]byte{}, message[:6]...), trailerFrame...)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			w := newResponseWriter(AutoContentType, false)
+			w.rpcProtocol = rpcGRPCWeb
+			w.Header().Set("Content-Type", "application/grpc-web+proto")
+			if c.trailers {
+				w.Header().Set("Trailer", "Grpc-Status")
+			}
+			w.Write(c.body)
+			if c.trailers {
+				w.Header().Set("Grpc-Status", "0")
+			}
+			w.finalize()
+
+			assert.Equal(c.expected, w.Body())
+			assert.Equal("", w.lockedHeader.Get("Grpc-Status"))
+			assert.True(w.IsBinary())
+		})
+	}
+}
+
+func TestGRPCWebStatus(t *testing.T) {
+	message := grpcWebFrame(0, []byte("hello"))
+
+	cases := []struct {
+		name     string
+		status   int
+		body     []byte
+		trailers http.Header
+		expected int
+	}{
+		{name: "ok", body: message, trailers: http.Header{"Grpc-Status": {"0"}}, expected: http.StatusOK},
+		{name: "trailers", body: message, trailers: http.Header{"Grpc-Status": {"5"}}, expected: http.StatusNotFound},
+		{name: "trailer frame", body: append(append([]byte{}, message...), grpcWebFrame(0x80, []byte("grpc-message: denied\r\nGrpc-Status: 7\r\n"))...), expected: http.StatusForbidden},
+		{name: "unknown code", body: message, trailers: http.Header{"Grpc-Status": {"42"}}, expected: http.StatusInternalServerError},
+		{name: "explicit status", status: http.StatusTeapot, body: message, trailers: http.Header{"Grpc-Status": {"5"}}, expected: http.StatusTeapot},
+		{name: "trailers-only", trailers: http.Header{"Grpc-Status": {"5"}}, expected: http.StatusOK},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			w := newResponseWriter(AutoContentType, false)
+			w.rpcProtocol = rpcGRPCWeb
+			w.Header().Set("Content-Type", "application/grpc-web+proto")
+			for k := range c.trailers {
+				w.Header().Add("Trailer", k)
+			}
+			if c.status != 0 {
+				w.WriteHeader(c.status)
+			}
+			w.Write(c.body)
+			for k, v := range c.trailers {
+				w.Header()[k] = v
+			}
+			w.finalize()
+
+			assert.Equal(c.expected, w.StatusCode())
+		})
+	}
+}
+
+func TestGRPCStatusToHTTP(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(http.StatusOK, GRPCStatusToHTTP(0))
+	assert.Equal(499, GRPCStatusToHTTP(1))
+	assert.Equal(http.StatusInternalServerError, GRPCStatusToHTTP(2))
+	assert.Equal(http.StatusBadRequest, GRPCStatusToHTTP(3))
+	assert.Equal(http.StatusNotFound, GRPCStatusToHTTP(5))
+	assert.Equal(http.StatusUnauthorized, GRPCStatusToHTTP(16))
+	assert.Equal(http.StatusInternalServerError, GRPCStatusToHTTP(17))
+}
+
+func TestConnect(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/proto")
+		w.Write([]byte{0x0a, 0x05, 'h', 'e', 'l', 'l', 'o'})
+	}), WithGRPCWeb())
+
+	req := Request{
+		Version: "2.0",
+		RawPath: "/echo.Echo/Echo",
+		Headers: map[string]string{"content-type": "application/proto", "connect-protocol-version": "1"},
+	}
+	req.RequestContext.HTTP.Method = http.MethodPost
+
+	res, err := h(context.Background(), req)
+	assert.NoError(err)
+	assert.True(res.IsBase64Encoded)
+	assert.Equal(base64.StdEncoding.EncodeToString([]byte{0x0a, 0x05, 'h', 'e', 'l', 'l', 'o'}), res.Body)
+}
+
+func TestConnectResponses(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		binary      bool
+		expected    int
+	}{
+		{name: "json", contentType: "application/json", body: `{"sentence":"hello"}`, expected: http.StatusOK},
+		{name: "json stream", contentType: "application/connect+json", body: "\x00\x00\x00\x00\x02{}", binary: true, expected: http.StatusOK},
+		{name: "custom stream", contentType: "application/connect+cbor", body: "\x00\x00\x00\x00\x01\xa0", binary: true, expected: http.StatusOK},
+		{name: "error", contentType: "application/json", body: `{"code":"not_found","message":"no such sentence"}`, expected: http.StatusNotFound},
+		{name: "error with details", contentType: "application/json", body: `{"code":"unavailable","details":[]}`, expected: http.StatusServiceUnavailable},
+		{name: "unknown error code", contentType: "application/json", body: `{"code":"not_a_code"}`, expected: http.StatusOK},
+		{name: "error-like message", contentType: "application/json", body: `{"code":"internal","sentence":"hello"}`, expected: http.StatusOK},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", c.contentType)
+				w.Write([]byte(c.body))
+			}), WithGRPCWeb())
+
+			req := Request{
+				Version: "2.0",
+				RawPath: "/echo.Echo/Echo",
+				Headers: map[string]string{"content-type": c.contentType, "connect-protocol-version": "1"},
+			}
+			req.RequestContext.HTTP.Method = http.MethodPost
+
+			res, err := h(context.Background(), req)
+			assert.NoError(err)
+			assert.Equal(c.expected, res.StatusCode)
+			assert.Equal(c.binary, res.IsBase64Encoded)
+		})
+	}
+}
+
+func TestDecodeGRPCWebText(t *testing.T) {
+	assert := assert.New(t)
+
+	a := grpcWebFrame(0, []byte("a"))
+	b := grpcWebFrame(0x80, []byte("grpc-status: 0\r\n"))
+	data, err := decodeGRPCWebText([]byte(base64.StdEncoding.EncodeToString(a) + base64.StdEncoding.EncodeToString(b)))
+	assert.NoError(err)
+	assert.Equal(append(a, b...), data)
+}
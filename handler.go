@@ -3,12 +3,19 @@ package lambada
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/morelj/httptools/header"
 )
 
+// errHandlerPanicked is the error logged when the http.Handler panics.
+var errHandlerPanicked = errors.New("http.Handler panicked")
+
 // LambdaHandler is a Lambada lambda handler function which can be used with lambda.Start.
 type LambadaHandler func(ctx context.Context, req Request) (Response, error)
 
@@ -17,49 +24,171 @@ type LambadaHandler func(ctx context.Context, req Request) (Response, error)
 // the response into an API Gateway response.
 func NewHandler(h http.Handler, options ...Option) LambadaHandler {
 	opts := newOptions(options...)
+	var access *accessLog
+	if opts.accessLogger != nil {
+		access = &accessLog{logger: opts.accessLogger}
+	}
+
+	return func(ctx context.Context, req Request) (res Response, err error) {
+		start := time.Now()
+		// The loggers state and the logging environment variables are evaluated for each invocation
+		logs := newEventLogFromEnv(opts)
+		// panicked is set while the http.Handler runs, and remains set if it panics
+		panicked := false
+		if logs != nil {
+			logs.start(&req)
+			// req is modified during the conversion, the original event is logged
+			event := req
+			defer func() {
+				if panicked {
+					logs.end(&event, nil, errHandlerPanicked, time.Since(start))
+					return
+				}
+				logs.end(&event, &res, err, time.Since(start))
+			}()
+		}
+		var bodySize int
+		if access != nil {
+			defer func() {
+				if panicked {
+					// No response is produced: the panic is reported by the Lambda runtime as an invocation error
+					access.log(ctx, start, &req, &Response{StatusCode: http.StatusInternalServerError}, 0, errHandlerPanicked)
+					return
+				}
+				access.log(ctx, start, &req, &res, bodySize, err)
+			}()
+		}
+		if opts.capture != nil {
+			// req is modified during the conversion, the original event is captured
+			event := req
+			defer func() {
+				opts.capture.record(event, &res, err, panicked)
+			}()
+		}
 
-	return func(ctx context.Context, req Request) (Response, error) {
-		opts.requestLogger.Printf("Got request: %s\n", marshalJSON(&req))
+		var ids requestIDs
+		if opts.requestIDHeader != "" {
+			ctx, ids = withRequestIDs(ctx, opts.requestIDHeader, &req)
+		}
+
+		obs := opts.observers
+		if len(obs) > 0 {
+			ctx = obs.EventReceived(ctx, &req)
+			defer func() {
+				if err != nil {
+					obs.Error(ctx, err)
+				}
+			}()
+		}
 
+		debug := opts.diagnostics != nil && opts.diagnostics.enabled(&req)
 		w := newResponseWriter(opts.outputMode, opts.defaultBinary)
 
 		// Find out which version it is
+		convertStart := time.Now()
 		var httpRequest *http.Request
-		var err error
 		if req.Version == "2.0" {
 			httpRequest, err = makeV2Request(ctx, &req)
 		} else {
-			httpRequest, err = makeV1Request(ctx, &req)
+			httpRequest, err = makeV1Request(ctx, &req, opts.requestBodyDecoder)
 		}
 		if err != nil {
 			return Response{}, err
 		}
+		httpRequest = attachTraceContext(ctx, httpRequest)
+		decodeDuration := time.Since(convertStart)
+		if len(obs) > 0 {
+			obs.RequestConverted(httpRequest, decodeDuration)
+		}
+		if opts.grpcWeb {
+			w.rpcProtocol = detectRPCProtocol(httpRequest)
+			if w.rpcProtocol == rpcGRPCWebText {
+				if err := prepareGRPCWebTextRequest(httpRequest); err != nil {
+					return Response{}, err
+				}
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			w.deadlines.setLambdaDeadline(deadline)
+		}
+		if httpRequest.Body != http.NoBody {
+			// Handlers may compare the body to http.NoBody, which must then be kept as is
+			httpRequest.Body = &deadlineReader{ReadCloser: httpRequest.Body, deadlines: w.deadlines}
+		}
+		if opts.requestIDHeader != "" {
+			setRequestIDHeaders(opts.requestIDHeader, ids, httpRequest, w)
+		}
+		w.compression = opts.compression
+		w.binDetectors = opts.binDetectors
+		w.request = httpRequest
+		w.etag = opts.etag
+		w.trailerMode = opts.trailerMode
+		w.trailerEncoder = opts.trailerEncoder
 
 		// Let the handler process the request
-		h.ServeHTTP(w, httpRequest)
+		handlerStart := time.Now()
+		panicked = true
+		if len(obs) > 0 {
+			serveObserved(obs, h, w, httpRequest)
+		} else {
+			h.ServeHTTP(w, httpRequest)
+		}
+		panicked = false
+		handlerDuration := time.Since(handlerStart)
+		encodeStart := time.Now()
 		w.finalize()
+		if opts.trailerMode == DropTrailers && len(w.trailers) > 0 {
+			opts.responseLogger.Printf("Warning: dropped response trailers %v\n", opts.redactor.redactTrailers(w.trailers))
+		}
 
-		res := Response{
+		bodySize = w.body.Len()
+		body := bytesToBody(w.body.Bytes(), w.binary)
+		if debug {
+			opts.diagnostics.setHeaders(w.lockedHeader, &req, w, timings{
+				decode:  decodeDuration,
+				handler: handlerDuration,
+				encode:  time.Since(encodeStart),
+				total:   time.Since(start),
+			})
+		}
+
+		res = Response{
 			StatusCode:        w.statusCode,
 			Headers:           toSingleValueHeaders(w.lockedHeader),
 			MultiValueHeaders: w.lockedHeader,
-			Body:              bytesToBody(w.body.Bytes(), w.binary),
+			Body:              body,
 			IsBase64Encoded:   w.binary,
 		}
-		opts.responseLogger.Printf("Response: %s\n", marshalJSON(&res))
+		if req.Version == "2.0" {
+			// API Gateway V2 and Function URLs ignore MultiValueHeaders: cookies have to be set using Cookies
+			res.Cookies = w.lockedHeader.Values(header.SetCookie)
+			delete(res.Headers, header.SetCookie)
+		}
+		if len(obs) > 0 {
+			obs.ResponseEncoded(ctx, &res, time.Since(encodeStart))
+		}
 		return res, nil
 	}
 }
 
 // Serve starts the Lambda handler using the http.Handler to serve incoming requests.
-// Serve calls lambda.Start(NewHandler(h)) under the hood.
+// Serve calls ServeWithOptions(h) under the hood.
 func Serve(h http.Handler) {
 	ServeWithOptions(h)
 }
 
 // ServeWithOptions starts the lambda handler using the http.Handler and options to serve incoming requests.
 // ServeWithOptions calls lambda.Start(NewHandler(h, options...)) under the hood.
+//
+// When not running in Lambda (see IsLambda), ServeWithOptions starts a local development server instead, using
+// net/http. The server listens on the address set using WithLocalAddr, or the LAMBADA_LOCAL_ADDR environment
+// variable, or DefaultLocalAddr. By default, requests are passed directly to h. WithLocalEmulation may be used to
+// pass them through a simulated API Gateway event round-trip.
+// If the local server cannot be started, the program exits.
 func ServeWithOptions(h http.Handler, options ...Option) {
+	if !IsLambda() {
+		log.Fatal(serveLocal(h, options...))
+	}
 	lambda.Start(NewHandler(h, options...))
 }
 
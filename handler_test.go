@@ -0,0 +1,59 @@
+package lambada
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHandler(t *testing.T) {
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Add("X-Multi", "1")
+		w.Header().Add("X-Multi", "2")
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte{1, 2, 3})
+	}), WithOutputMode(Automatic))
+
+	v2 := Request{Version: "2.0", RawPath: "/"}
+	v2.RequestContext.HTTP.Method = http.MethodPut
+
+	cases := map[string]Request{
+		"v1": {HTTPMethod: http.MethodPut, Path: "/"},
+		"v2": v2,
+	}
+
+	for name, req := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			res, err := h(context.Background(), req)
+			require.NoError(err)
+			assert.Equal(http.StatusCreated, res.StatusCode)
+			assert.Equal("PUT", res.Headers["X-Method"])
+			assert.Equal("1", res.Headers["X-Multi"])
+			assert.Equal([]string{"1", "2"}, res.MultiValueHeaders["X-Multi"])
+			if req.Version == "2.0" {
+				assert.Equal([]string{"a=1", "b=2"}, res.Cookies)
+				assert.NotContains(res.Headers, "Set-Cookie")
+			} else {
+				assert.Nil(res.Cookies)
+			}
+			assert.True(res.IsBase64Encoded)
+			assert.Equal("AQID", res.Body)
+		})
+	}
+}
+
+func TestNewHandlerInvalidRequest(t *testing.T) {
+	h := NewHandler(http.NotFoundHandler())
+	_, err := h(context.Background(), Request{HTTPMethod: http.MethodGet, Body: "invalid", IsBase64Encoded: true})
+	assert.Error(t, err)
+}
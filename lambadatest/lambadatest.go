@@ -0,0 +1,322 @@
+// Package lambadatest provides utilities to test http.Handler served through lambada: builders for API Gateway V1, V2,
+// ALB and Function URL events, a one-call invocation helper, and a decoded response type.
+//
+// Example:
+//
+//	res, err := lambadatest.V2(http.MethodPost, "/items?draft=true").
+//	    Header("Authorization", "Bearer token").
+//	    JSON(map[string]string{"name": "item"}).
+//	    Invoke(handler, lambada.WithOutputMode(lambada.Automatic))
+package lambadatest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/rajarathnabalan/lambada"
+	"github.com/rajarathnabalan/lambada/jwtclaims"
+)
+
+// EventBuilder builds Lambda events.
+// EventBuilder methods return the builder itself, allowing calls to be chained. Errors (e.g. JSON marshalling
+// errors) are reported by Build.
+type EventBuilder struct {
+	format  lambada.EventFormat
+	method  string
+	target  string
+	query   url.Values
+	header  http.Header
+	cookies []*http.Cookie
+	body    []byte
+	binary  bool
+	stage   string
+	claims  jwtclaims.Claims
+	scopes  []string
+	err     error
+
+	principalID   string
+	lambdaContext map[string]interface{}
+}
+
+// NewEvent returns a new EventBuilder building events of the given format.
+// target is the request path, which may include a query string.
+func NewEvent(format lambada.EventFormat, method, target string) *EventBuilder {
+	return &EventBuilder{
+		format: format,
+		method: method,
+		target: target,
+		query:  url.Values{},
+		header: http.Header{},
+	}
+}
+
+// V1 returns a new EventBuilder building API Gateway V1 (REST API) events.
+func V1(method, target string) *EventBuilder {
+	return NewEvent(lambada.EventFormatV1, method, target)
+}
+
+// V2 returns a new EventBuilder building API Gateway V2 (HTTP API) events.
+func V2(method, target string) *EventBuilder {
+	return NewEvent(lambada.EventFormatV2, method, target)
+}
+
+// ALB returns a new EventBuilder building ALB target group events.
+func ALB(method, target string) *EventBuilder {
+	return NewEvent(lambada.EventFormatALB, method, target)
+}
+
+// FunctionURL returns a new EventBuilder building Lambda Function URL events.
+func FunctionURL(method, target string) *EventBuilder {
+	return NewEvent(lambada.EventFormatFunctionURL, method, target)
+}
+
+// Query adds a query parameter.
+func (b *EventBuilder) Query(key, value string) *EventBuilder {
+	b.query.Add(key, value)
+	return b
+}
+
+// Header adds a header.
+func (b *EventBuilder) Header(key, value string) *EventBuilder {
+	b.header.Add(key, value)
+	return b
+}
+
+// Cookie adds a cookie.
+func (b *EventBuilder) Cookie(name, value string) *EventBuilder {
+	b.cookies = append(b.cookies, &http.Cookie{Name: name, Value: value})
+	return b
+}
+
+// Stage sets the API Gateway stage.
+func (b *EventBuilder) Stage(stage string) *EventBuilder {
+	b.stage = stage
+	return b
+}
+
+// Body sets the request body and its content type.
+// Whether the body is Base64 encoded in the event depends on the content type, as API Gateway would do.
+func (b *EventBuilder) Body(contentType string, body []byte) *EventBuilder {
+	b.header.Set("Content-Type", contentType)
+	b.body = body
+	return b
+}
+
+// JSON sets the request body to the JSON representation of v, with an application/json content type.
+func (b *EventBuilder) JSON(v interface{}) *EventBuilder {
+	data, err := json.Marshal(v)
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	return b.Body("application/json", data)
+}
+
+// Binary sets the request body and its content type. The body is always Base64 encoded in the event.
+func (b *EventBuilder) Binary(contentType string, body []byte) *EventBuilder {
+	b.binary = true
+	return b.Body(contentType, body)
+}
+
+// Claims sets the claims, and optionally scopes, of the authorizer which authenticated the request: the JWT authorizer
+// for V2 events, or the Cognito User Pools authorizer for V1 events, in which case the scopes are set as the scope
+// claim. Other formats do not support authorizers, and Build returns an error.
+func (b *EventBuilder) Claims(claims jwtclaims.Claims, scopes ...string) *EventBuilder {
+	b.claims = claims
+	b.scopes = scopes
+	return b
+}
+
+// LambdaAuthorizer sets the principal id and context returned by a Lambda authorizer.
+// As with API Gateway, V2 events do not include the principal id, and V1 events hold the context values as strings.
+// Other formats do not support authorizers, and Build returns an error. Build also returns an error if Claims has been
+// called as well, as a route has a single authorizer.
+func (b *EventBuilder) LambdaAuthorizer(principalID string, authorizerContext map[string]interface{}) *EventBuilder {
+	b.principalID = principalID
+	if authorizerContext == nil {
+		authorizerContext = map[string]interface{}{}
+	}
+	b.lambdaContext = authorizerContext
+	return b
+}
+
+// Build builds the event.
+func (b *EventBuilder) Build() (lambada.Request, error) {
+	if b.err != nil {
+		return lambada.Request{}, b.err
+	}
+
+	r := httptest.NewRequest(b.method, b.target, bytes.NewReader(b.body))
+	if len(b.query) > 0 {
+		query := r.URL.Query()
+		for k, v := range b.query {
+			query[k] = append(query[k], v...)
+		}
+		r.URL.RawQuery = query.Encode()
+	}
+	for k, v := range b.header {
+		r.Header[k] = v
+	}
+	for _, cookie := range b.cookies {
+		r.AddCookie(cookie)
+	}
+
+	req, err := lambada.NewEvent(r, b.format, lambada.WithEmulatorStage(b.stage))
+	if err != nil {
+		return lambada.Request{}, err
+	}
+
+	if b.binary && !req.IsBase64Encoded {
+		req.Body = base64.StdEncoding.EncodeToString(b.body)
+		req.IsBase64Encoded = true
+	}
+	if b.claims != nil && b.lambdaContext != nil {
+		return lambada.Request{}, errors.New("authorizer claims and a lambda authorizer can't be set on the same event")
+	}
+	if b.claims != nil {
+		switch b.format {
+		case lambada.EventFormatV2:
+			jwt := &lambada.JWTAuthorizer{Claims: b.claims}
+			if b.scopes != nil {
+				jwt.Scopes = b.scopes
+			}
+			req.RequestContext.Authorizer = &lambada.Authorizer{JWT: jwt}
+		case lambada.EventFormatV1:
+			claims := b.claims
+			if len(b.scopes) > 0 {
+				claims = jwtclaims.Claims{}
+				for k, v := range b.claims {
+					claims[k] = v
+				}
+				claims["scope"] = strings.Join(b.scopes, " ")
+			}
+			req.RequestContext.Authorizer = &lambada.Authorizer{Claims: claims}
+		default:
+			return lambada.Request{}, fmt.Errorf("authorizer claims are not supported by %s events", b.format)
+		}
+	}
+	if b.lambdaContext != nil {
+		switch b.format {
+		case lambada.EventFormatV2, lambada.EventFormatV1:
+			req.RequestContext.Authorizer = b.lambdaAuthorizer()
+		default:
+			return lambada.Request{}, fmt.Errorf("lambda authorizers are not supported by %s events", b.format)
+		}
+	}
+
+	return *req, nil
+}
+
+// Invoke builds the event and invokes h with it. See Invoke.
+func (b *EventBuilder) Invoke(h http.Handler, options ...lambada.Option) (*Response, error) {
+	req, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	return Invoke(h, req, options...)
+}
+
+// Invoke invokes h through lambada.NewHandler with the given event and options, and returns the decoded response.
+func Invoke(h http.Handler, event lambada.Request, options ...lambada.Option) (*Response, error) {
+	return InvokeContext(context.Background(), h, event, options...)
+}
+
+// InvokeContext is the same as Invoke, using ctx as the Lambda invocation context.
+func InvokeContext(ctx context.Context, h http.Handler, event lambada.Request, options ...lambada.Option) (*Response, error) {
+	res, err := lambada.NewHandler(h, options...)(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(event, res)
+}
+
+// Response is a decoded lambada.Response.
+type Response struct {
+	// StatusCode is the response status code
+	StatusCode int
+
+	// Header contains the response headers, merged from Headers, MultiValueHeaders (see Decode) and Cookies
+	Header http.Header
+
+	// Body is the response body, decoded from Base64 if needed
+	Body []byte
+
+	// Raw is the original response
+	Raw lambada.Response
+}
+
+// Decode decodes res, the response to event.
+// As AWS does, MultiValueHeaders are only used for V1 events, and for ALB events having multi-value headers enabled
+// (see lambada.Request.MultiValueResponse).
+func Decode(event lambada.Request, res lambada.Response) (*Response, error) {
+	var body []byte
+	if res.IsBase64Encoded {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(res.Body); err != nil {
+			return nil, err
+		}
+	} else {
+		body = []byte(res.Body)
+	}
+
+	h := http.Header{}
+	for k, v := range res.Headers {
+		h.Set(k, v)
+	}
+	if event.MultiValueResponse() {
+		for k, v := range res.MultiValueHeaders {
+			h[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+	for _, cookie := range res.Cookies {
+		h.Add("Set-Cookie", cookie)
+	}
+
+	return &Response{
+		StatusCode: res.StatusCode,
+		Header:     h,
+		Body:       body,
+		Raw:        res,
+	}, nil
+}
+
+// Cookies parses and returns the cookies set by the response.
+func (r *Response) Cookies() []*http.Cookie {
+	return (&http.Response{Header: r.Header}).Cookies()
+}
+
+// String returns the body as a string.
+func (r *Response) String() string {
+	return string(r.Body)
+}
+
+// JSON decodes the JSON body into v.
+func (r *Response) JSON(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// lambdaAuthorizer returns the Lambda authorizer set using LambdaAuthorizer, using the format of the event.
+func (b *EventBuilder) lambdaAuthorizer() *lambada.Authorizer {
+	if b.format == lambada.EventFormatV2 {
+		return &lambada.Authorizer{Lambda: b.lambdaContext}
+	}
+
+	values := make(lambada.LambdaAuthorizerContext, len(b.lambdaContext))
+	for k, v := range b.lambdaContext {
+		switch v.(type) {
+		case string, bool, int, int64, float64, json.Number:
+			values[k] = fmt.Sprint(v)
+		default:
+			data, _ := json.Marshal(v)
+			values[k] = string(data)
+		}
+	}
+	return &lambada.Authorizer{PrincipalID: b.principalID, Lambda: values}
+}
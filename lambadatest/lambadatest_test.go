@@ -0,0 +1,203 @@
+package lambadatest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/rajarathnabalan/lambada"
+	"github.com/rajarathnabalan/lambada/jwtclaims"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoHandler responds with a JSON description of the request
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	cookie, _ := r.Cookie("session")
+
+	res := map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"query":  r.URL.Query(),
+		"header": r.Header.Get("X-Test"),
+		"body":   body,
+	}
+	if cookie != nil {
+		res["cookie"] = cookie.Value
+	}
+	if principal := lambada.GetPrincipal(r); principal != nil {
+		res["sub"] = principal.Subject
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: "a", Value: "1"})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+})
+
+func TestInvoke(t *testing.T) {
+	cases := []struct {
+		name    string
+		builder *EventBuilder
+		sub     string
+	}{
+		{name: "v1", builder: V1(http.MethodPost, "/items?a=1").Claims(jwtclaims.Claims{"sub": "user"}), sub: "user"},
+		{name: "v2", builder: V2(http.MethodPost, "/items?a=1").Claims(jwtclaims.Claims{"sub": "user"}), sub: "user"},
+		{name: "alb", builder: ALB(http.MethodPost, "/items?a=1")},
+		{name: "url", builder: FunctionURL(http.MethodPost, "/items?a=1")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			res, err := c.builder.
+				Query("b", "x y").
+				Header("X-Test", "value").
+				Cookie("session", "xyz").
+				Binary("application/octet-stream", []byte{0, 1, 2}).
+				Invoke(echoHandler)
+			require.NoError(err)
+
+			assert.Equal(http.StatusOK, res.StatusCode)
+			assert.Equal("application/json", res.Header.Get("Content-Type"))
+			require.Len(res.Cookies(), 1)
+			assert.Equal("a", res.Cookies()[0].Name)
+
+			var body struct {
+				Method string
+				Path   string
+				Query  map[string][]string
+				Header string
+				Body   []byte
+				Cookie string
+				Sub    string
+			}
+			require.NoError(res.JSON(&body))
+			assert.Equal(http.MethodPost, body.Method)
+			assert.Equal("/items", body.Path)
+			assert.Equal(map[string][]string{"a": {"1"}, "b": {"x y"}}, body.Query)
+			assert.Equal("value", body.Header)
+			assert.Equal([]byte{0, 1, 2}, body.Body)
+			assert.Equal("xyz", body.Cookie)
+			assert.Equal(c.sub, body.Sub)
+		})
+	}
+}
+
+func TestClaims(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	claims := jwtclaims.Claims{"sub": "user"}
+
+	req, err := V2(http.MethodGet, "/").Claims(claims, "items/read").Build()
+	require.NoError(err)
+	require.NotNil(req.RequestContext.Authorizer.JWT)
+	assert.Equal(claims, req.RequestContext.Authorizer.JWT.Claims)
+	assert.Equal([]string{"items/read"}, req.RequestContext.Authorizer.JWT.Scopes)
+
+	// REST APIs use the Cognito User Pools authorizer shape
+	req, err = V1(http.MethodGet, "/").Claims(claims, "items/read", "items/write").Build()
+	require.NoError(err)
+	assert.Nil(req.RequestContext.Authorizer.JWT)
+	assert.Equal(jwtclaims.Claims{"sub": "user", "scope": "items/read items/write"}, req.RequestContext.Authorizer.Claims)
+	assert.Equal(jwtclaims.Claims{"sub": "user"}, claims)
+	p := req.Principal()
+	require.NotNil(p)
+	assert.Equal(lambada.PrincipalCognito, p.Type)
+	assert.Equal([]string{"items/read", "items/write"}, p.Scopes)
+
+	_, err = ALB(http.MethodGet, "/").Claims(claims).Build()
+	assert.Error(err)
+	_, err = FunctionURL(http.MethodGet, "/").Claims(claims).Build()
+	assert.Error(err)
+}
+
+func TestBuild(t *testing.T) {
+	assert := assert.New(t)
+
+	req, err := V2(http.MethodPut, "/items").Stage("prod").JSON(map[string]int{"a": 1}).Build()
+	assert.NoError(err)
+	assert.Equal("2.0", req.Version)
+	assert.Equal("/prod/items", req.RawPath)
+	assert.Equal(`{"a":1}`, req.Body)
+	assert.False(req.IsBase64Encoded)
+	assert.Equal("application/json", req.Headers["content-type"])
+
+	_, err = V1(http.MethodPost, "/").JSON(func() {}).Build()
+	assert.Error(err)
+}
+
+func TestDecode(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := Decode(lambada.Request{HTTPMethod: http.MethodGet}, lambada.Response{
+		StatusCode:        http.StatusTeapot,
+		Headers:           map[string]string{"content-type": "text/plain"},
+		MultiValueHeaders: map[string][]string{"X-Multi": {"1", "2"}},
+		Cookies:           []string{"a=1", "b=2"},
+		Body:              "SGVsbG8=",
+		IsBase64Encoded:   true,
+	})
+	assert.NoError(err)
+	assert.Equal(http.StatusTeapot, res.StatusCode)
+	assert.Equal("text/plain", res.Header.Get("Content-Type"))
+	assert.Equal([]string{"1", "2"}, res.Header.Values("X-Multi"))
+	assert.Len(res.Cookies(), 2)
+	assert.Equal("Hello", res.String())
+
+	_, err = Decode(lambada.Request{}, lambada.Response{Body: "invalid", IsBase64Encoded: true})
+	assert.Error(err)
+
+	// API Gateway V2 and single-value ALB ignore MultiValueHeaders
+	multiValueOnly := lambada.Response{StatusCode: http.StatusOK, MultiValueHeaders: map[string][]string{"X-Multi": {"1", "2"}}}
+	for _, event := range []lambada.Request{
+		{Version: "2.0"},
+		{RequestContext: lambada.RequestContext{ELB: &events.ELBContext{}}},
+	} {
+		res, err = Decode(event, multiValueOnly)
+		assert.NoError(err)
+		assert.Empty(res.Header.Values("X-Multi"))
+	}
+	res, err = Decode(lambada.Request{
+		RequestContext:    lambada.RequestContext{ELB: &events.ELBContext{}},
+		MultiValueHeaders: map[string][]string{},
+	}, multiValueOnly)
+	assert.NoError(err)
+	assert.Equal([]string{"1", "2"}, res.Header.Values("X-Multi"))
+}
+
+func TestLambdaAuthorizer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	context := map[string]interface{}{"tenant": "t1", "level": 3, "admin": true}
+
+	req, err := V1(http.MethodGet, "/").LambdaAuthorizer("user", context).Build()
+	require.NoError(err)
+	a := req.RequestContext.Authorizer
+	assert.Equal("user", a.PrincipalID)
+	assert.Equal(lambada.LambdaAuthorizerContext{"tenant": "t1", "level": "3", "admin": "true"}, a.Lambda)
+
+	req, err = V2(http.MethodGet, "/").LambdaAuthorizer("user", context).Build()
+	require.NoError(err)
+	a = req.RequestContext.Authorizer
+	assert.Empty(a.PrincipalID)
+	assert.Equal(lambada.LambdaAuthorizerContext(context), a.Lambda)
+
+	level, ok := a.Lambda.Int64("level")
+	assert.True(ok)
+	assert.Equal(int64(3), level)
+
+	_, err = ALB(http.MethodGet, "/").LambdaAuthorizer("user", context).Build()
+	assert.EqualError(err, "lambda authorizers are not supported by alb events")
+	_, err = FunctionURL(http.MethodGet, "/").LambdaAuthorizer("user", context).Build()
+	assert.EqualError(err, "lambda authorizers are not supported by url events")
+
+	_, err = V2(http.MethodGet, "/").Claims(jwtclaims.Claims{"sub": "user"}).LambdaAuthorizer("user", context).Build()
+	assert.Error(err)
+}
@@ -0,0 +1,64 @@
+package lambada
+
+import (
+	"log"
+	"net/http"
+	"os"
+)
+
+// LocalAddrEnv is the name of the environment variable which may be used to set the address of the local development
+// server.
+const LocalAddrEnv = "LAMBADA_LOCAL_ADDR"
+
+// DefaultLocalAddr is the default address of the local development server.
+const DefaultLocalAddr = ":8080"
+
+// WithLocalAddr sets the address the local development server listens on.
+// This takes precedence over the LAMBADA_LOCAL_ADDR environment variable.
+// See ServeWithOptions for details.
+func WithLocalAddr(addr string) Option {
+	return func(o *options) {
+		o.localAddr = addr
+	}
+}
+
+// WithLocalEmulation makes the local development server pass the requests through a simulated API Gateway event
+// round-trip: the incoming requests are converted into Lambda events of the given format, then converted back to
+// http.Request by Lambada, and the Lambda response is converted back into an HTTP response.
+// This way, the local behavior (binary encoding, header folding, cookies, stage prefixes...) matches production.
+//
+// stage is the name of the simulated API Gateway stage. An empty stage means the $default stage.
+// See ServeWithOptions for details.
+func WithLocalEmulation(format EventFormat, stage string) Option {
+	return func(o *options) {
+		o.localFormat = format
+		o.localStage = stage
+	}
+}
+
+// localServerAddr returns the address of the local development server.
+func (o *options) localServerAddr() string {
+	if o.localAddr != "" {
+		return o.localAddr
+	}
+	if addr := os.Getenv(LocalAddrEnv); addr != "" {
+		return addr
+	}
+	return DefaultLocalAddr
+}
+
+// newLocalHandler returns the http.Handler served by the local development server.
+func newLocalHandler(h http.Handler, opts *options, options ...Option) http.Handler {
+	if opts.localFormat == 0 {
+		return h
+	}
+	return NewEmulator(NewHandler(h, options...), opts.localFormat, WithEmulatorStage(opts.localStage))
+}
+
+// serveLocal starts the local development server.
+func serveLocal(h http.Handler, options ...Option) error {
+	opts := newOptions(options...)
+	addr := opts.localServerAddr()
+	log.Printf("Not running in Lambda, starting local server on %s\n", addr)
+	return http.ListenAndServe(addr, newLocalHandler(h, opts, options...))
+}
@@ -0,0 +1,86 @@
+package lambada
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalServerAddr(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv(LocalAddrEnv, "")
+	assert.Equal(DefaultLocalAddr, newOptions().localServerAddr())
+
+	os.Setenv(LocalAddrEnv, ":9000")
+	defer os.Setenv(LocalAddrEnv, "")
+	assert.Equal(":9000", newOptions().localServerAddr())
+	assert.Equal("127.0.0.1:3000", newOptions(WithLocalAddr("127.0.0.1:3000")).localServerAddr())
+}
+
+func TestLocalHandler(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, _ := r.Cookie("session")
+		body, _ := io.ReadAll(r.Body)
+
+		w.Header().Set("X-Path", r.URL.Path)
+		w.Header().Set("X-Query", r.URL.Query().Get("q"))
+		w.Header().Set("X-Lambda", fmt.Sprint(GetRequest(r) != nil))
+		if cookie != nil {
+			w.Header().Set("X-Cookie", cookie.Value)
+		}
+		http.SetCookie(w, &http.Cookie{Name: "a", Value: "1"})
+		http.SetCookie(w, &http.Cookie{Name: "b", Value: "2"})
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(body)
+	})
+
+	cases := []struct {
+		options []Option
+		path    string
+		lambda  string
+	}{
+		{options: nil, path: "/hello", lambda: "false"},
+		{options: []Option{WithLocalEmulation(EventFormatV1, "")}, path: "/hello", lambda: "true"},
+		{options: []Option{WithLocalEmulation(EventFormatV2, "")}, path: "/hello", lambda: "true"},
+		{options: []Option{WithLocalEmulation(EventFormatV2, "prod")}, path: "/prod/hello", lambda: "true"},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			options := append([]Option{WithOutputMode(Automatic)}, c.options...)
+			srv := httptest.NewServer(newLocalHandler(h, newOptions(options...), options...))
+			defer srv.Close()
+
+			body := []byte{0, 1, 2, 0xff}
+			req, err := http.NewRequest(http.MethodPost, srv.URL+"/hello?q=a%20b", bytes.NewReader(body))
+			require.NoError(err)
+			req.Header.Set("Content-Type", "application/octet-stream")
+			req.AddCookie(&http.Cookie{Name: "session", Value: "xyz"})
+
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(err)
+			defer res.Body.Close()
+			resBody, err := io.ReadAll(res.Body)
+			require.NoError(err)
+
+			assert.Equal(http.StatusOK, res.StatusCode)
+			assert.Equal(body, resBody)
+			assert.Equal(c.path, res.Header.Get("X-Path"))
+			assert.Equal("a b", res.Header.Get("X-Query"))
+			assert.Equal("xyz", res.Header.Get("X-Cookie"))
+			assert.Equal(c.lambda, res.Header.Get("X-Lambda"))
+			assert.Len(res.Cookies(), 2)
+		})
+	}
+}
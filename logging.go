@@ -0,0 +1,164 @@
+package lambada
+
+import (
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// LogLevelEnv is the name of the environment variable holding the Lambda log level (set by Lambda's advanced
+	// logging controls). It controls which invocations are logged by the request and response loggers, and is read at
+	// the start of each invocation:
+	//   - TRACE, DEBUG: all the invocations are logged, regardless of the sampling.
+	//   - INFO (or unset): the invocations are logged according to WithLogSampling and WithLogSlowThreshold.
+	//   - WARN: only failed and slow invocations are logged.
+	//   - ERROR, FATAL: only failed invocations are logged.
+	LogLevelEnv = "AWS_LAMBDA_LOG_LEVEL"
+
+	// LogSampleRateEnv is the name of the environment variable overriding the rate set using WithLogSampling.
+	// Its value is a number between 0 and 1, and is read at the start of each invocation.
+	LogSampleRateEnv = "LAMBADA_LOG_SAMPLE_RATE"
+)
+
+// WithLogSampling only logs a fraction of the successful invocations using the request and response loggers.
+// rate is a number between 0 (no successful invocation is logged) and 1 (all the invocations are logged).
+// Failed invocations (i.e. returning an error or a 5xx status code) are always logged, as are slow invocations (see
+// WithLogSlowThreshold).
+//
+// When sampling is enabled, the event is logged along with the response, once the invocation is complete.
+// The rate may be overridden at runtime using the LAMBADA_LOG_SAMPLE_RATE environment variable. See also LogLevelEnv.
+func WithLogSampling(rate float64) Option {
+	return func(o *options) {
+		o.logSampleRate = &rate
+	}
+}
+
+// WithLogSlowThreshold always logs the invocations lasting at least threshold, regardless of the sampling.
+// This option enables sampling (see WithLogSampling), with a rate of 1 unless set otherwise.
+func WithLogSlowThreshold(threshold time.Duration) Option {
+	return func(o *options) {
+		o.logSlowThreshold = threshold
+	}
+}
+
+// loggerEnabled returns whether l actually logs messages.
+// NullLogger is disabled, as are the loggers implementing an Enabled method returning false. It is called at the start
+// of each invocation.
+func loggerEnabled(l Logger) bool {
+	switch l := l.(type) {
+	case nil, NullLogger, *NullLogger:
+		return false
+	case interface{ Enabled() bool }:
+		return l.Enabled()
+	}
+	return true
+}
+
+// eventLog logs the events and responses of the invocations to the request and response loggers.
+type eventLog struct {
+	requestLogger  Logger
+	responseLogger Logger
+	redactor       *redactor
+
+	// sampled is true when invocations are logged once complete, depending on their outcome
+	sampled       bool
+	sampleRate    float64
+	slowThreshold time.Duration
+	errorsOnly    bool
+}
+
+// newEventLog returns the eventLog of an invocation, given the options and the values of the LogLevelEnv and
+// LogSampleRateEnv environment variables.
+// It returns nil if both the request and response loggers are disabled.
+func newEventLog(opts *options, level, sampleRate string) *eventLog {
+	requestEnabled, responseEnabled := loggerEnabled(opts.requestLogger), loggerEnabled(opts.responseLogger)
+	if !requestEnabled && !responseEnabled {
+		return nil
+	}
+
+	l := &eventLog{
+		redactor:      opts.redactor,
+		sampleRate:    1,
+		slowThreshold: opts.logSlowThreshold,
+		sampled:       opts.logSampleRate != nil || opts.logSlowThreshold > 0,
+	}
+	if requestEnabled {
+		l.requestLogger = opts.requestLogger
+	}
+	if responseEnabled {
+		l.responseLogger = opts.responseLogger
+	}
+	if opts.logSampleRate != nil {
+		l.sampleRate = *opts.logSampleRate
+	}
+	if rate, err := strconv.ParseFloat(sampleRate, 64); err == nil {
+		l.sampled = true
+		l.sampleRate = rate
+	}
+
+	switch strings.ToUpper(level) {
+	case "TRACE", "DEBUG":
+		l.sampled = false
+	case "WARN":
+		l.sampled = true
+		l.sampleRate = 0
+	case "ERROR", "FATAL":
+		l.sampled = true
+		l.sampleRate = 0
+		l.errorsOnly = true
+	}
+	return l
+}
+
+// newEventLogFromEnv returns the eventLog of an invocation, using the environment variables of the process.
+func newEventLogFromEnv(opts *options) *eventLog {
+	return newEventLog(opts, os.Getenv(LogLevelEnv), os.Getenv(LogSampleRateEnv))
+}
+
+// start is called when an invocation starts. Unless sampling is enabled, the event is logged immediately.
+func (l *eventLog) start(req *Request) {
+	if !l.sampled {
+		l.logRequest(req)
+	}
+}
+
+// end is called once the invocation is complete, with the original event.
+// res must be nil if err is not nil.
+func (l *eventLog) end(event *Request, res *Response, err error, duration time.Duration) {
+	if l.sampled {
+		if !l.keep(res, err, duration) {
+			return
+		}
+		l.logRequest(event)
+		if err != nil && l.responseLogger != nil {
+			l.responseLogger.Printf("Error: %v\n", err)
+		}
+	}
+	if err == nil && l.responseLogger != nil {
+		l.responseLogger.Printf("Response: %s\n", marshalJSON(l.redactor.redactResponse(*res)))
+	}
+}
+
+// keep returns whether a sampled invocation must be logged.
+func (l *eventLog) keep(res *Response, err error, duration time.Duration) bool {
+	if err != nil || res.StatusCode >= http.StatusInternalServerError {
+		return true
+	}
+	if l.errorsOnly {
+		return false
+	}
+	if l.slowThreshold > 0 && duration >= l.slowThreshold {
+		return true
+	}
+	return l.sampleRate >= 1 || rand.Float64() < l.sampleRate
+}
+
+func (l *eventLog) logRequest(req *Request) {
+	if l.requestLogger != nil {
+		l.requestLogger.Printf("Got request: %s\n", marshalJSON(l.redactor.redactRequest(*req)))
+	}
+}
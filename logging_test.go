@@ -0,0 +1,211 @@
+package lambada
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type disabledLogger struct {
+	recordingLogger
+}
+
+func (l *disabledLogger) Enabled() bool {
+	return false
+}
+
+// toggledLogger is a logger which may be enabled at runtime
+type toggledLogger struct {
+	recordingLogger
+	enabled bool
+}
+
+func (l *toggledLogger) Enabled() bool {
+	return l.enabled
+}
+
+// unmarshallable fails the test if it is marshalled
+type unmarshallable struct {
+	t *testing.T
+}
+
+func (u unmarshallable) MarshalJSON() ([]byte, error) {
+	u.t.Error("unexpected marshalling")
+	return []byte("null"), nil
+}
+
+func TestLoggerEnabled(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(loggerEnabled(nil))
+	assert.False(loggerEnabled(NullLogger{}))
+	assert.False(loggerEnabled(&NullLogger{}))
+	assert.False(loggerEnabled(&disabledLogger{}))
+	assert.True(loggerEnabled(&recordingLogger{}))
+}
+
+func TestNewEventLog(t *testing.T) {
+	cases := []struct {
+		name       string
+		options    []Option
+		level      string
+		sampleRate string
+		sampled    bool
+		rate       float64
+		errorsOnly bool
+	}{
+		{name: "default", rate: 1},
+		{name: "sampling", options: []Option{WithLogSampling(0.1)}, sampled: true, rate: 0.1},
+		{name: "slow", options: []Option{WithLogSlowThreshold(time.Second)}, sampled: true, rate: 1},
+		{name: "env rate", options: []Option{WithLogSampling(0.1)}, sampleRate: "0.5", sampled: true, rate: 0.5},
+		{name: "invalid env rate", sampleRate: "invalid", rate: 1},
+		{name: "debug", options: []Option{WithLogSampling(0.1)}, level: "debug", rate: 0.1},
+		{name: "info", options: []Option{WithLogSampling(0.1)}, level: "INFO", sampled: true, rate: 0.1},
+		{name: "warn", level: "WARN", sampled: true, rate: 0},
+		{name: "error", level: "ERROR", sampled: true, rate: 0, errorsOnly: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			opts := newOptions(append([]Option{WithLogger(&recordingLogger{})}, c.options...)...)
+			l := newEventLog(opts, c.level, c.sampleRate)
+			assert.Equal(c.sampled, l.sampled)
+			assert.Equal(c.rate, l.sampleRate)
+			assert.Equal(c.errorsOnly, l.errorsOnly)
+		})
+	}
+
+	assert.Nil(t, newEventLog(newOptions(), "DEBUG", "1"))
+	assert.Nil(t, newEventLog(newOptions(WithLogger(&disabledLogger{})), "", ""))
+}
+
+func TestEventLogKeep(t *testing.T) {
+	assert := assert.New(t)
+
+	ok := &Response{StatusCode: http.StatusOK}
+	failed := &Response{StatusCode: http.StatusBadGateway}
+
+	l := &eventLog{sampled: true, sampleRate: 0, slowThreshold: time.Second}
+	assert.False(l.keep(ok, nil, time.Millisecond))
+	assert.True(l.keep(ok, nil, time.Second))
+	assert.True(l.keep(failed, nil, time.Millisecond))
+	assert.True(l.keep(nil, errors.New("boom"), time.Millisecond))
+
+	l.errorsOnly = true
+	assert.False(l.keep(ok, nil, time.Second))
+	assert.True(l.keep(failed, nil, time.Millisecond))
+
+	l = &eventLog{sampled: true, sampleRate: 1}
+	assert.True(l.keep(ok, nil, time.Millisecond))
+}
+
+func TestEventLogging(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	t.Run("immediate", func(t *testing.T) {
+		logger := &recordingLogger{}
+		h := NewHandler(handler, WithRequestLogger(logger))
+		_, err := h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/"})
+		require.NoError(t, err)
+		require.Len(t, logger.messages, 1)
+		assert.True(t, strings.HasPrefix(logger.messages[0], "Got request: "))
+	})
+
+	t.Run("sampled", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		logger := &recordingLogger{}
+		h := NewHandler(handler, WithLogger(logger), WithLogSampling(0))
+
+		_, err := h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/"})
+		require.NoError(err)
+		assert.Empty(logger.messages)
+
+		_, err = h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/fail"})
+		require.NoError(err)
+		require.Len(logger.messages, 2)
+		assert.Contains(logger.messages[0], `"path":"/fail"`)
+		assert.Contains(logger.messages[1], `"statusCode":500`)
+
+		logger.messages = nil
+		_, err = h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/", Body: "invalid", IsBase64Encoded: true})
+		require.Error(err)
+		require.Len(logger.messages, 2)
+		assert.True(strings.HasPrefix(logger.messages[1], "Error: "))
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		logger := &recordingLogger{}
+		h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}), WithLogger(logger), WithLogSampling(0))
+		assert.Panics(func() {
+			h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/"})
+		})
+		require.Len(logger.messages, 2)
+		assert.Equal("Error: http.Handler panicked\n", logger.messages[1])
+	})
+
+	t.Run("level", func(t *testing.T) {
+		t.Setenv(LogLevelEnv, "ERROR")
+		logger := &recordingLogger{}
+		h := NewHandler(handler, WithLogger(logger))
+		_, err := h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/"})
+		require.NoError(t, err)
+		assert.Empty(t, logger.messages)
+	})
+
+	t.Run("runtime", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		// The loggers state and the environment variables are evaluated for each invocation
+		logger := &toggledLogger{}
+		h := NewHandler(handler, WithLogger(logger))
+		req := Request{HTTPMethod: http.MethodGet, Path: "/"}
+		_, err := h(context.Background(), req)
+		require.NoError(err)
+		assert.Empty(logger.messages)
+
+		logger.enabled = true
+		_, err = h(context.Background(), req)
+		require.NoError(err)
+		assert.Len(logger.messages, 2)
+
+		logger.messages = nil
+		t.Setenv(LogLevelEnv, "ERROR")
+		_, err = h(context.Background(), req)
+		require.NoError(err)
+		assert.Empty(logger.messages)
+
+		t.Setenv(LogLevelEnv, "DEBUG")
+		_, err = h(context.Background(), req)
+		require.NoError(err)
+		assert.Len(logger.messages, 2)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		// Disabled loggers do not cause the events to be marshalled
+		h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), WithLogger(&disabledLogger{}))
+		req := Request{HTTPMethod: http.MethodGet, Path: "/"}
+		req.RequestContext.Authorizer = &Authorizer{JWT: &JWTAuthorizer{Scopes: unmarshallable{t: t}}}
+		_, err := h(context.Background(), req)
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,372 @@
+package lambada
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+// DefaultMetricsNamespace is the default CloudWatch namespace of the metrics emitted by WithMetrics.
+const DefaultMetricsNamespace = "Lambada"
+
+// A MetricUnit is the unit of a CloudWatch metric.
+type MetricUnit string
+
+// Common CloudWatch metric units. See the CloudWatch documentation for the complete list.
+const (
+	UnitNone         MetricUnit = "None"
+	UnitCount        MetricUnit = "Count"
+	UnitPercent      MetricUnit = "Percent"
+	UnitSeconds      MetricUnit = "Seconds"
+	UnitMilliseconds MetricUnit = "Milliseconds"
+	UnitMicroseconds MetricUnit = "Microseconds"
+	UnitBytes        MetricUnit = "Bytes"
+	UnitKilobytes    MetricUnit = "Kilobytes"
+	UnitMegabytes    MetricUnit = "Megabytes"
+)
+
+// A MetricDimension is a dimension of the metrics emitted by WithMetrics.
+type MetricDimension string
+
+const (
+	// MetricDimensionAPIID is the API Gateway API id.
+	MetricDimensionAPIID MetricDimension = "ApiId"
+
+	// MetricDimensionStage is the API Gateway stage.
+	MetricDimensionStage MetricDimension = "Stage"
+
+	// MetricDimensionRoute is the route template (e.g. /items/{id}).
+	MetricDimensionRoute MetricDimension = "Route"
+
+	// MetricDimensionMethod is the request method.
+	MetricDimensionMethod MetricDimension = "Method"
+
+	// MetricDimensionFunction is the Lambda function name.
+	MetricDimensionFunction MetricDimension = "FunctionName"
+)
+
+// DefaultMetricDimensions are the dimensions used when none are passed to WithMetrics.
+var DefaultMetricDimensions = []MetricDimension{MetricDimensionAPIID, MetricDimensionStage, MetricDimensionRoute}
+
+// missingDimension is the value of the dimensions not available for an invocation.
+const missingDimension = "none"
+
+// metricsTimeoutMargin is how long before the invocation deadline the record of an invocation still running is
+// written, as a timed out invocation is never complete.
+const metricsTimeoutMargin = 50 * time.Millisecond
+
+// WithMetrics emits metrics using the CloudWatch Embedded Metric Format (EMF): one JSON record per invocation is
+// written to w, which must be the standard output for CloudWatch to extract the metrics.
+// If namespace is empty, DefaultMetricsNamespace is used. If no dimensions are given, DefaultMetricDimensions are
+// used.
+//
+// The following metrics are emitted:
+//   - Latency: the duration of the invocation (milliseconds)
+//   - 2xx, 3xx, 4xx, 5xx: 1 for the status class of the response, 0 for the others
+//   - ResponseBytes: the size of the response body (bytes)
+//   - Binary: 1 if the response is binary
+//   - ColdStart: 1 for the first invocation handled by the handler
+//   - Timeout: 1 if the invocation deadline was exceeded
+//   - Panic: 1 if the http.Handler panicked (the record is written before the panic is propagated)
+//   - Error: 1 if the invocation failed
+//
+// Lambda stops the function when the invocation deadline is reached, before the handler returns. The record of an
+// invocation still running shortly before its deadline (see metricsTimeoutMargin) is therefore written at that time,
+// with Timeout and Error set to 1 and without the response metrics.
+//
+// Handlers can add their own metrics and properties to the record using GetMetrics.
+func WithMetrics(w io.Writer, namespace string, dimensions ...MetricDimension) Option {
+	if namespace == "" {
+		namespace = DefaultMetricsNamespace
+	}
+	if len(dimensions) == 0 {
+		dimensions = DefaultMetricDimensions
+	}
+	m := &metricsObserver{
+		w:          w,
+		namespace:  namespace,
+		dimensions: dimensions,
+	}
+	return WithObserver(m)
+}
+
+// Metrics buffers the metrics and properties of an invocation, which are written in a single EMF record once the
+// invocation is complete.
+// A nil *Metrics (returned by GetMetrics when metrics are disabled) silently ignores all the calls.
+type Metrics struct {
+	mu         sync.Mutex
+	start      time.Time
+	event      *Request
+	names      []string
+	units      map[string]MetricUnit
+	values     map[string][]float64
+	properties map[string]interface{}
+	emitted    bool
+
+	// timer emits the record when the invocation is about to time out
+	timer *time.Timer
+}
+
+type metricsKeyType struct{}
+
+var metricsKey = metricsKeyType{}
+
+// MetricsFromContext returns the Metrics of the invocation attached to ctx, or nil if metrics are disabled.
+func MetricsFromContext(ctx context.Context) *Metrics {
+	m, _ := ctx.Value(metricsKey).(*Metrics)
+	return m
+}
+
+// GetMetrics returns the Metrics of the invocation which issued r, or nil if metrics are disabled (see WithMetrics).
+func GetMetrics(r *http.Request) *Metrics {
+	return MetricsFromContext(r.Context())
+}
+
+// Put adds a value to the metric name. Putting several values to the same metric results in a values array.
+// The unit of a metric is the one set by the first call.
+// Metric names must not collide with the dimensions or the properties.
+func (m *Metrics) Put(name string, value float64, unit MetricUnit) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[name] = append(m.define(name, unit), value)
+}
+
+// define declares the metric name if needed, and returns its current values. m.mu must be held.
+func (m *Metrics) define(name string, unit MetricUnit) []float64 {
+	if _, ok := m.units[name]; !ok {
+		m.names = append(m.names, name)
+		m.units[name] = unit
+	}
+	return m.values[name]
+}
+
+// SetProperty sets a property of the record. Properties are not metrics, but can be searched using CloudWatch Logs
+// Insights.
+func (m *Metrics) SetProperty(key string, value interface{}) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.properties[key] = value
+}
+
+// metricsObserver is the Observer emitting the metrics.
+type metricsObserver struct {
+	NopObserver
+
+	w          io.Writer
+	namespace  string
+	dimensions []MetricDimension
+
+	mu   sync.Mutex
+	warm bool
+}
+
+func (o *metricsObserver) EventReceived(ctx context.Context, event *Request) context.Context {
+	o.mu.Lock()
+	coldStart := !o.warm
+	o.warm = true
+	o.mu.Unlock()
+
+	// The event is modified during the conversion
+	e := *event
+	m := &Metrics{
+		start:      time.Now(),
+		event:      &e,
+		units:      map[string]MetricUnit{},
+		values:     map[string][]float64{},
+		properties: map[string]interface{}{},
+	}
+	m.Put("ColdStart", boolMetric(coldStart), UnitCount)
+	if deadline, ok := ctx.Deadline(); ok {
+		if d := time.Until(deadline) - metricsTimeoutMargin; d > 0 {
+			m.mu.Lock()
+			m.timer = time.AfterFunc(d, func() { o.timeout(m) })
+			m.mu.Unlock()
+		}
+	}
+	if id := LambdaRequestIDFromContext(ctx); id != "" {
+		m.SetProperty("lambdaRequestId", id)
+	}
+	requestID := RequestIDFromContext(ctx)
+	if requestID == "" {
+		requestID = event.RequestContext.RequestID
+	}
+	if requestID != "" {
+		m.SetProperty("requestId", requestID)
+	}
+	return context.WithValue(ctx, metricsKey, m)
+}
+
+func (o *metricsObserver) HandlerFinished(r *http.Request, info HandlerInfo) {
+	m := GetMetrics(r)
+	m.Put("Panic", boolMetric(info.Panicked), UnitCount)
+	if info.Panicked {
+		// The panic is propagated to the Lambda runtime, which reports it as an invocation error: the response is
+		// never encoded
+		m.Put("Error", 1, UnitCount)
+		o.emit(m, deadlineExceeded(r.Context()))
+	}
+}
+
+func (o *metricsObserver) ResponseEncoded(ctx context.Context, res *Response, duration time.Duration) {
+	m := MetricsFromContext(ctx)
+	size := len(res.Body)
+	if res.IsBase64Encoded {
+		size = base64DecodedLen(res.Body)
+	}
+
+	class := res.StatusCode / 100
+	for c := 2; c <= 5; c++ {
+		m.Put(strconv.Itoa(c)+"xx", boolMetric(class == c), UnitCount)
+	}
+	m.Put("ResponseBytes", float64(size), UnitBytes)
+	m.Put("Binary", boolMetric(res.IsBase64Encoded), UnitCount)
+	m.Put("Error", 0, UnitCount)
+	o.emit(m, deadlineExceeded(ctx))
+}
+
+func (o *metricsObserver) Error(ctx context.Context, err error) {
+	m := MetricsFromContext(ctx)
+	m.Put("Error", 1, UnitCount)
+	o.emit(m, deadlineExceeded(ctx))
+}
+
+// deadlineExceeded returns whether the deadline of ctx was exceeded.
+func deadlineExceeded(ctx context.Context) bool {
+	return ctx.Err() == context.DeadlineExceeded
+}
+
+// claim returns true the first time it is called, and stops the timeout timer. The record of an invocation is only
+// written by the first caller.
+func (m *Metrics) claim() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	if m.emitted {
+		return false
+	}
+	m.emitted = true
+	return true
+}
+
+// timeout writes the EMF record of an invocation which is about to time out.
+func (o *metricsObserver) timeout(m *Metrics) {
+	if m.claim() {
+		o.write(m, true, true)
+	}
+}
+
+// emit writes the EMF record of a complete invocation, unless it has already been written.
+func (o *metricsObserver) emit(m *Metrics, timedOut bool) {
+	if m != nil && m.claim() {
+		o.write(m, timedOut, false)
+	}
+}
+
+// write writes the EMF record of an invocation. running is true when the invocation is about to be stopped by Lambda:
+// it is reported as failed, and its goroutine may still be putting metrics.
+func (o *metricsObserver) write(m *Metrics, timedOut, running bool) {
+	m.mu.Lock()
+	if running {
+		m.define("Error", UnitCount)
+		m.values["Error"] = []float64{1}
+	}
+	m.values["Timeout"] = append(m.define("Timeout", UnitCount), boolMetric(timedOut))
+	m.values["Latency"] = append(m.define("Latency", UnitMilliseconds), float64(time.Since(m.start))/float64(time.Millisecond))
+	record := o.record(m)
+	m.mu.Unlock()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.w.Write(append(data, '\n'))
+}
+
+// emfMetric is the definition of a metric in an EMF record.
+type emfMetric struct {
+	Name string     `json:"Name"`
+	Unit MetricUnit `json:"Unit,omitempty"`
+}
+
+// record builds the EMF record of m. m.mu must be held.
+func (o *metricsObserver) record(m *Metrics) map[string]interface{} {
+	record := make(map[string]interface{}, len(m.properties)+len(o.dimensions)+len(m.names)+1)
+	for k, v := range m.properties {
+		record[k] = v
+	}
+
+	dimensions := make([]string, len(o.dimensions))
+	for i, d := range o.dimensions {
+		dimensions[i] = string(d)
+		record[string(d)] = o.dimensionValue(d, m.event)
+	}
+
+	metrics := make([]emfMetric, len(m.names))
+	for i, name := range m.names {
+		metrics[i] = emfMetric{Name: name, Unit: m.units[name]}
+		if values := m.values[name]; len(values) == 1 {
+			record[name] = values[0]
+		} else {
+			record[name] = values
+		}
+	}
+
+	record["_aws"] = map[string]interface{}{
+		"Timestamp": m.start.UnixNano() / int64(time.Millisecond),
+		"CloudWatchMetrics": []interface{}{
+			map[string]interface{}{
+				"Namespace":  o.namespace,
+				"Dimensions": [][]string{dimensions},
+				"Metrics":    metrics,
+			},
+		},
+	}
+	return record
+}
+
+// dimensionValue returns the value of the dimension d for event.
+func (o *metricsObserver) dimensionValue(d MetricDimension, event *Request) string {
+	var value string
+	switch d {
+	case MetricDimensionAPIID:
+		value = event.RequestContext.APIID
+	case MetricDimensionStage:
+		value = event.RequestContext.Stage
+	case MetricDimensionRoute:
+		value = routeTemplate(event)
+	case MetricDimensionMethod:
+		value = event.HTTPMethod
+		if event.Version == "2.0" {
+			value = event.RequestContext.HTTP.Method
+		}
+	case MetricDimensionFunction:
+		value = lambdacontext.FunctionName
+	}
+	if value == "" {
+		return missingDimension
+	}
+	return value
+}
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
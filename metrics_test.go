@@ -0,0 +1,190 @@
+package lambada
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeEMF(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var record map[string]interface{}
+		require.NoError(t, dec.Decode(&record))
+		records = append(records, record)
+	}
+	return records
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
+
+func TestMetrics(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var buf bytes.Buffer
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := GetMetrics(r)
+		m.Put("Items", 2, UnitCount)
+		m.Put("Items", 3, UnitCount)
+		m.SetProperty("customer", "c1")
+
+		switch r.URL.Path {
+		case "/panic":
+			panic("boom")
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{1, 2, 3})
+		}
+	}), WithOutputMode(Automatic), WithMetrics(&buf, ""))
+
+	req := Request{Resource: "/items/{id}", HTTPMethod: http.MethodGet, Path: "/items/1"}
+	req.RequestContext.APIID = "api"
+	req.RequestContext.Stage = "prod"
+	req.RequestContext.RequestID = "apigw-id"
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "lambda-id"})
+
+	_, err := h(ctx, req)
+	require.NoError(err)
+	req.Path = "/missing"
+	_, err = h(ctx, req)
+	require.NoError(err)
+	req.Path = "/panic"
+	assert.Panics(func() { h(ctx, req) })
+	_, err = h(ctx, Request{HTTPMethod: http.MethodGet, Body: "invalid", IsBase64Encoded: true})
+	require.Error(err)
+
+	records := decodeEMF(t, &buf)
+	require.Len(records, 4)
+
+	// Successful invocation
+	record := records[0]
+	aws := record["_aws"].(map[string]interface{})
+	assert.NotZero(aws["Timestamp"])
+	cwm := aws["CloudWatchMetrics"].([]interface{})[0].(map[string]interface{})
+	assert.Equal("Lambada", cwm["Namespace"])
+	assert.Equal([]interface{}{[]interface{}{"ApiId", "Stage", "Route"}}, cwm["Dimensions"])
+	assert.Contains(cwm["Metrics"], map[string]interface{}{"Name": "Latency", "Unit": "Milliseconds"})
+	assert.Contains(cwm["Metrics"], map[string]interface{}{"Name": "Items", "Unit": "Count"})
+
+	assert.Equal("api", record["ApiId"])
+	assert.Equal("prod", record["Stage"])
+	assert.Equal("/items/{id}", record["Route"])
+	assert.Equal("lambda-id", record["lambdaRequestId"])
+	assert.Equal("apigw-id", record["requestId"])
+	assert.Equal("c1", record["customer"])
+	assert.Equal([]interface{}{float64(2), float64(3)}, record["Items"])
+	assert.Equal(float64(1), record["ColdStart"])
+	assert.Equal(float64(1), record["2xx"])
+	assert.Equal(float64(0), record["4xx"])
+	assert.Equal(float64(3), record["ResponseBytes"])
+	assert.Equal(float64(1), record["Binary"])
+	assert.Equal(float64(0), record["Panic"])
+	assert.Equal(float64(0), record["Error"])
+	assert.Equal(float64(0), record["Timeout"])
+	assert.IsType(float64(0), record["Latency"])
+
+	// Not found
+	assert.Equal(float64(0), records[1]["ColdStart"])
+	assert.Equal(float64(1), records[1]["4xx"])
+	assert.Equal(float64(0), records[1]["Binary"])
+
+	// Panic
+	assert.Equal(float64(1), records[2]["Panic"])
+	assert.Equal(float64(1), records[2]["Error"])
+
+	// Error
+	assert.Equal(float64(1), records[3]["Error"])
+	assert.Equal("none", records[3]["ApiId"])
+	assert.NotContains(records[3], "2xx")
+}
+
+func TestMetricsTimeout(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.WriteHeader(http.StatusGatewayTimeout)
+	}), WithMetrics(&buf, "Custom", MetricDimensionMethod))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := h(ctx, Request{HTTPMethod: http.MethodPost, Path: "/"})
+	require.NoError(t, err)
+
+	records := decodeEMF(t, &buf)
+	require.Len(t, records, 1)
+	assert.Equal(t, float64(1), records[0]["Timeout"])
+	assert.Equal(t, float64(1), records[0]["5xx"])
+	assert.Equal(t, "POST", records[0]["Method"])
+}
+
+func TestMetricsTimeoutBeforeCompletion(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var buf lockedBuffer
+	beforeDeadline := false
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		GetMetrics(r).Put("Items", 1, UnitCount)
+		for r.Context().Err() == nil && buf.Len() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		beforeDeadline = r.Context().Err() == nil
+		<-r.Context().Done()
+		w.WriteHeader(http.StatusGatewayTimeout)
+	}), WithMetrics(&buf, ""))
+
+	ctx, cancel := context.WithTimeout(context.Background(), metricsTimeoutMargin+50*time.Millisecond)
+	defer cancel()
+	_, err := h(ctx, Request{HTTPMethod: http.MethodGet, Path: "/"})
+	require.NoError(err)
+
+	// The record is written before the deadline, as Lambda stops the function once it is reached
+	assert.True(beforeDeadline)
+	records := decodeEMF(t, &buf.buf)
+	require.Len(records, 1)
+	assert.Equal(float64(1), records[0]["Timeout"])
+	assert.Equal(float64(1), records[0]["Error"])
+	assert.Equal(float64(1), records[0]["Items"])
+	assert.NotContains(records[0], "5xx")
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	// A nil Metrics ignores the calls
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := GetMetrics(r)
+		assert.Nil(t, m)
+		m.Put("Items", 1, UnitCount)
+		m.SetProperty("a", "b")
+	}))
+	_, err := h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/"})
+	require.NoError(t, err)
+}
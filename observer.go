@@ -0,0 +1,154 @@
+package lambada
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// An Observer is notified of the steps of every invocation. It allows to instrument the invocations (e.g. tracing
+// spans, metrics or audit logs) without wrapping Lambada's internals.
+//
+// The methods are called in the following order, from the invocation goroutine: EventReceived, RequestConverted,
+// HandlerStarted, HandlerFinished, ResponseEncoded. If the invocation fails, Error is called instead of the remaining
+// methods.
+// Embed NopObserver to only implement some of the methods.
+type Observer interface {
+	// EventReceived is called when a Lambda event is received, prior any processing.
+	// The returned context is used for the rest of the invocation, and is the parent of the http.Request context.
+	EventReceived(ctx context.Context, event *Request) context.Context
+
+	// RequestConverted is called once the event has been converted into r. duration is the time spent converting the
+	// event.
+	RequestConverted(r *http.Request, duration time.Duration)
+
+	// HandlerStarted is called right before the http.Handler is called.
+	HandlerStarted(r *http.Request)
+
+	// HandlerFinished is called when the http.Handler returns or panics. In the latter case, the panic is propagated
+	// once all the observers have been notified.
+	HandlerFinished(r *http.Request, info HandlerInfo)
+
+	// ResponseEncoded is called once the Lambda response has been built. duration is the time spent finalizing and
+	// encoding the response (content detection, compression, ETags...).
+	ResponseEncoded(ctx context.Context, res *Response, duration time.Duration)
+
+	// Error is called when the invocation fails, i.e. when the handler returns an error to Lambda.
+	Error(ctx context.Context, err error)
+}
+
+// HandlerInfo describes the execution of an http.Handler.
+type HandlerInfo struct {
+	// StatusCode is the status code set by the handler.
+	StatusCode int
+
+	// BodySize is the number of bytes written by the handler.
+	BodySize int
+
+	// Duration is the time spent in the handler.
+	Duration time.Duration
+
+	// Panicked is true if the handler panicked.
+	Panicked bool
+
+	// Panic is the value the handler panicked with, or nil if it returned normally. Panic may be nil even though the
+	// handler panicked, if it called panic(nil) (before Go 1.21, or with GODEBUG=panicnil=1): use Panicked instead.
+	Panic interface{}
+
+	// Stack is the stack trace of the goroutine at the time the handler panicked, as returned by debug.Stack, or nil
+	// if it returned normally. It includes the frames of the handler, down to the call to panic.
+	Stack []byte
+}
+
+// NopObserver is an Observer doing nothing. It is intended to be embedded in Observer implementations.
+type NopObserver struct{}
+
+func (NopObserver) EventReceived(ctx context.Context, event *Request) context.Context {
+	return ctx
+}
+
+func (NopObserver) RequestConverted(r *http.Request, duration time.Duration) {}
+
+func (NopObserver) HandlerStarted(r *http.Request) {}
+
+func (NopObserver) HandlerFinished(r *http.Request, info HandlerInfo) {}
+
+func (NopObserver) ResponseEncoded(ctx context.Context, res *Response, duration time.Duration) {}
+
+func (NopObserver) Error(ctx context.Context, err error) {}
+
+// WithObserver registers an Observer notified of the steps of every invocation.
+// This option can be used multiple times, in which case the observers are notified in registration order.
+func WithObserver(observer Observer) Option {
+	return func(o *options) {
+		o.observers = append(o.observers, observer)
+	}
+}
+
+// observers notifies a list of observers.
+type observers []Observer
+
+func (obs observers) EventReceived(ctx context.Context, event *Request) context.Context {
+	for _, o := range obs {
+		ctx = o.EventReceived(ctx, event)
+	}
+	return ctx
+}
+
+func (obs observers) RequestConverted(r *http.Request, duration time.Duration) {
+	for _, o := range obs {
+		o.RequestConverted(r, duration)
+	}
+}
+
+func (obs observers) HandlerStarted(r *http.Request) {
+	for _, o := range obs {
+		o.HandlerStarted(r)
+	}
+}
+
+func (obs observers) HandlerFinished(r *http.Request, info HandlerInfo) {
+	for _, o := range obs {
+		o.HandlerFinished(r, info)
+	}
+}
+
+func (obs observers) ResponseEncoded(ctx context.Context, res *Response, duration time.Duration) {
+	for _, o := range obs {
+		o.ResponseEncoded(ctx, res, duration)
+	}
+}
+
+func (obs observers) Error(ctx context.Context, err error) {
+	for _, o := range obs {
+		o.Error(ctx, err)
+	}
+}
+
+// serveObserved calls h, notifying obs of the execution of the handler. Panics are propagated once obs has been
+// notified.
+func serveObserved(obs observers, h http.Handler, w *ResponseWriter, r *http.Request) {
+	obs.HandlerStarted(r)
+	start := time.Now()
+	// panicked remains set if the handler panics, even with a nil value
+	panicked := true
+	defer func() {
+		info := HandlerInfo{
+			StatusCode: w.StatusCode(),
+			BodySize:   w.body.Len(),
+			Duration:   time.Since(start),
+			Panicked:   panicked,
+			Panic:      recover(),
+		}
+		if info.Panicked {
+			info.Stack = debug.Stack()
+		}
+		obs.HandlerFinished(r, info)
+		if info.Panicked {
+			panic(info.Panic)
+		}
+	}()
+	h.ServeHTTP(w, r)
+	panicked = false
+}
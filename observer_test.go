@@ -0,0 +1,119 @@
+package lambada
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type observerKeyType struct{}
+
+// recordingObserver records the calls it receives
+type recordingObserver struct {
+	name  string
+	calls []string
+	info  HandlerInfo
+	res   *Response
+	err   error
+}
+
+func (o *recordingObserver) EventReceived(ctx context.Context, event *Request) context.Context {
+	o.calls = append(o.calls, "EventReceived")
+	return context.WithValue(ctx, observerKeyType{}, o.name)
+}
+
+func (o *recordingObserver) RequestConverted(r *http.Request, duration time.Duration) {
+	o.calls = append(o.calls, "RequestConverted:"+r.Context().Value(observerKeyType{}).(string))
+}
+
+func (o *recordingObserver) HandlerStarted(r *http.Request) {
+	o.calls = append(o.calls, "HandlerStarted")
+}
+
+func (o *recordingObserver) HandlerFinished(r *http.Request, info HandlerInfo) {
+	o.calls = append(o.calls, "HandlerFinished")
+	o.info = info
+}
+
+func (o *recordingObserver) ResponseEncoded(ctx context.Context, res *Response, duration time.Duration) {
+	o.calls = append(o.calls, "ResponseEncoded")
+	o.res = res
+}
+
+func (o *recordingObserver) Error(ctx context.Context, err error) {
+	o.calls = append(o.calls, "Error")
+	o.err = err
+}
+
+func TestObserver(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	o1, o2 := &recordingObserver{name: "o1"}, &recordingObserver{name: "o2"}
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/panic":
+			w.WriteHeader(http.StatusAccepted)
+			panic("boom")
+		case "/panic-nil":
+			panic(nil)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("Hello"))
+		}
+	}), WithObserver(o1), WithObserver(o2))
+
+	res, err := h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/"})
+	require.NoError(err)
+	for _, o := range []*recordingObserver{o1, o2} {
+		// The context returned by the last observer is used
+		assert.Equal([]string{"EventReceived", "RequestConverted:o2", "HandlerStarted", "HandlerFinished", "ResponseEncoded"}, o.calls)
+		assert.Equal(http.StatusCreated, o.info.StatusCode)
+		assert.Equal(5, o.info.BodySize)
+		assert.False(o.info.Panicked)
+		assert.Nil(o.info.Panic)
+		assert.Nil(o.info.Stack)
+		assert.Equal(&res, o.res)
+		o.calls = nil
+	}
+
+	_, err = h(context.Background(), Request{HTTPMethod: http.MethodGet, Body: "invalid", IsBase64Encoded: true})
+	require.Error(err)
+	assert.Equal([]string{"EventReceived", "Error"}, o1.calls)
+	assert.Equal(err, o1.err)
+	o1.calls = nil
+
+	assert.PanicsWithValue("boom", func() {
+		h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/panic"})
+	})
+	assert.Equal([]string{"EventReceived", "RequestConverted:o2", "HandlerStarted", "HandlerFinished"}, o1.calls)
+	assert.True(o1.info.Panicked)
+	assert.Equal("boom", o1.info.Panic)
+	// The stack trace includes the frames of the handler
+	assert.Contains(string(o1.info.Stack), "lambada.TestObserver.func1(")
+	assert.Equal(http.StatusAccepted, o1.info.StatusCode)
+	o1.calls = nil
+
+	// The value is nil (unless running with Go 1.21+ semantics), but the panic is still reported and propagated
+	assert.Panics(func() {
+		h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/panic-nil"})
+	})
+	assert.Equal([]string{"EventReceived", "RequestConverted:o2", "HandlerStarted", "HandlerFinished"}, o1.calls)
+	assert.True(o1.info.Panicked)
+	assert.Contains(string(o1.info.Stack), "lambada.TestObserver.func1(")
+}
+
+func TestNopObserver(t *testing.T) {
+	type partialObserver struct {
+		NopObserver
+	}
+
+	h := NewHandler(http.NotFoundHandler(), WithObserver(partialObserver{}))
+	res, err := h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
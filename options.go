@@ -1,5 +1,10 @@
 package lambada
 
+import (
+	"strconv"
+	"time"
+)
+
 // OutputMode represents the way the request's output will be handled.
 // See the defined OutputMode cconstant to get details on available output modes and how they work.
 type OutputMode int8
@@ -21,7 +26,23 @@ const (
 	Automatic OutputMode = 1
 )
 
+// String returns the name of the output mode: manual, auto-content-type or automatic.
+func (m OutputMode) String() string {
+	switch m {
+	case Manual:
+		return "manual"
+	case AutoContentType:
+		return "auto-content-type"
+	case Automatic:
+		return "automatic"
+	}
+	return "OutputMode(" + strconv.Itoa(int(m)) + ")"
+}
+
 // A Logger interface. Provide a single Printf method, which is compatible with the standard library log package.
+//
+// A Logger may also implement an Enabled() bool method. When it returns false, Lambada does not serialize the events
+// and responses to log. Enabled is called at the start of each invocation, so the loggers may be enabled at runtime.
 type Logger interface {
 	Printf(fmt string, args ...interface{})
 }
@@ -31,11 +52,39 @@ type NullLogger struct{}
 
 func (l NullLogger) Printf(fmt string, args ...interface{}) {}
 
+// Enabled returns false.
+func (l NullLogger) Enabled() bool {
+	return false
+}
+
 type options struct {
 	requestLogger  Logger
 	responseLogger Logger
 	outputMode     OutputMode
 	defaultBinary  bool
+	compression    *compression
+	binDetectors   []binDetector
+	etag           bool
+	trailerMode    TrailerMode
+	trailerEncoder TrailerEncoder
+	grpcWeb        bool
+	localAddr      string
+	localFormat    EventFormat
+	localStage     string
+	capture        *capture
+	accessLogger   FieldLogger
+	redactor       *redactor
+	observers      observers
+
+	logSampleRate    *float64
+	logSlowThreshold time.Duration
+
+	requestIDHeader string
+	diagnostics     *diagnostics
+
+	requestBinDetectors   []binDetector
+	requestBodyDecoder    *requestBodyDecoder
+	requestDoubleDecoding bool
 }
 
 // newOptions creates a new options and applies opts.
@@ -47,6 +96,14 @@ func newOptions(opts ...Option) *options {
 		responseLogger: NullLogger{},
 	}
 	o.apply(opts...)
+	checkDiagnostics(o)
+	if o.requestBinDetectors != nil {
+		o.requestBodyDecoder = &requestBodyDecoder{
+			detectors:   o.requestBinDetectors,
+			logger:      o.requestLogger,
+			decodeTwice: o.requestDoubleDecoding,
+		}
+	}
 	return o
 }
 
@@ -96,3 +153,57 @@ func WithDefaultBinary(defaultBinary bool) Option {
 		o.defaultBinary = defaultBinary
 	}
 }
+
+// WithBinaryMediaTypes registers media types which must be considered binary by the automatic binary detection.
+// mediaTypes follow the syntax of API Gateway's binaryMediaTypes: exact media types (application/vnd.my-format),
+// type wildcards (image/*), suffixes (application/*+cbor) and */*. Parameters may be specified (e.g.
+// text/csv;charset=binary), in which case they must all match.
+//
+// Registered media types take precedence over the built-in rules, and are evaluated in registration order along
+// with the ones registered with WithTextMediaTypes.
+// This option has no effect unless the output mode is Automatic.
+func WithBinaryMediaTypes(mediaTypes ...string) Option {
+	return func(o *options) {
+		for _, mediaType := range mediaTypes {
+			o.binDetectors = append(o.binDetectors, newPatternBinDetector(mediaType, bsBinary))
+		}
+	}
+}
+
+// WithTextMediaTypes registers media types which must be considered text by the automatic binary detection.
+// See WithBinaryMediaTypes for details on the syntax and precedence.
+func WithTextMediaTypes(mediaTypes ...string) Option {
+	return func(o *options) {
+		for _, mediaType := range mediaTypes {
+			o.binDetectors = append(o.binDetectors, newPatternBinDetector(mediaType, bsText))
+		}
+	}
+}
+
+// WithRequestBinaryMediaTypes sets the binaryMediaTypes configured on the API Gateway REST API (V1).
+// mediaTypes follow the same syntax as WithBinaryMediaTypes.
+//
+// When set, the request bodies are validated against this configuration: unexpected Base64 encoding, bodies passed as
+// text while expected to be binary, and bodies which look double Base64 encoded are reported through the request
+// logger. Bodies are never modified, unless WithRequestDoubleBase64Decoding is used.
+// This option has no effect on API Gateway V2 (HTTP API) requests.
+func WithRequestBinaryMediaTypes(mediaTypes ...string) Option {
+	return func(o *options) {
+		if o.requestBinDetectors == nil {
+			o.requestBinDetectors = []binDetector{}
+		}
+		for _, mediaType := range mediaTypes {
+			o.requestBinDetectors = append(o.requestBinDetectors, newPatternBinDetector(mediaType, bsBinary))
+		}
+	}
+}
+
+// WithRequestDoubleBase64Decoding decodes a second time the binary request bodies which look Base64 encoded once
+// decoded (see WithRequestBinaryMediaTypes).
+// Use with care: valid bodies may look Base64 encoded (e.g. "abcd"), in which case they are corrupted. This option
+// should only be used when the clients are known to Base64 encode the bodies themselves.
+func WithRequestDoubleBase64Decoding() Option {
+	return func(o *options) {
+		o.requestDoubleDecoding = true
+	}
+}
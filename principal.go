@@ -0,0 +1,213 @@
+package lambada
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/rajarathnabalan/lambada/jwtclaims"
+)
+
+// PrincipalType is the type of authorizer which authenticated a Principal.
+type PrincipalType string
+
+const (
+	// PrincipalIAM is a principal authenticated using IAM (AWS SigV4), with either API Gateway V1 or V2.
+	PrincipalIAM PrincipalType = "iam"
+
+	// PrincipalJWT is a principal authenticated by the JWT authorizer of an HTTP API (V2).
+	PrincipalJWT PrincipalType = "jwt"
+
+	// PrincipalCognito is a principal authenticated by the Cognito User Pools authorizer of a REST API (V1).
+	PrincipalCognito PrincipalType = "cognito"
+
+	// PrincipalLambda is a principal authenticated by a Lambda authorizer, with either API Gateway V1 or V2.
+	PrincipalLambda PrincipalType = "lambda"
+)
+
+// Claims holding the username and groups of Cognito users.
+const (
+	cognitoUsernameClaim = "cognito:username"
+	cognitoGroupsClaim   = "cognito:groups"
+)
+
+// Keys of the Lambda authorizer context used to build a Principal.
+const (
+	lambdaPrincipalIDKey = "principalId"
+	lambdaUsernameKey    = "username"
+	lambdaGroupsKey      = "groups"
+	lambdaScopesKey      = "scopes"
+)
+
+// Principal is the normalized identity of the caller, regardless of the authorizer which authenticated it.
+type Principal struct {
+	// Type is the type of authorizer which authenticated the principal.
+	Type PrincipalType
+
+	// Subject is the unique identifier of the principal: the sub claim for JWT and Cognito, the user id (e.g.
+	// AIDACKCEVSQ6C2EXAMPLE) for IAM, the principal id for Lambda authorizers (the principalId context key for V2).
+	Subject string
+
+	// Username is the username claim (or cognito:username) for JWT and Cognito, and the username context key for
+	// Lambda authorizers. It is empty for IAM.
+	Username string
+
+	// Groups are the groups of the principal, from the cognito:groups claim or the groups context key.
+	Groups []string
+
+	// Scopes are the OAuth scopes of the principal, from the JWT authorizer scopes, the scope claim or the scopes
+	// context key.
+	Scopes []string
+
+	// AccountID is the AWS account id of IAM principals.
+	AccountID string
+
+	// ARN is the ARN of IAM principals.
+	ARN string
+
+	// Claims are the raw JWT claims, for JWT and Cognito.
+	Claims jwtclaims.Claims
+
+	// Context is the raw context returned by Lambda authorizers.
+	Context LambdaAuthorizerContext
+}
+
+// HasGroup returns whether the principal belongs to group.
+func (p *Principal) HasGroup(group string) bool {
+	return p != nil && contains(p.Groups, group)
+}
+
+// HasScope returns whether the principal has been granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && contains(p.Scopes, scope)
+}
+
+// Principal returns the identity of the caller, as set by the authorizer of the API, or nil if the request is not
+// authenticated.
+// The following authorizers are supported: IAM (V1 and V2), JWT (V2), Cognito User Pools (V1) and Lambda (V1 and V2).
+// The lists held by the Lambda authorizer context (groups and scopes) may be JSON arrays, or comma or space-separated
+// strings.
+func (r *Request) Principal() *Principal {
+	if a := r.RequestContext.Authorizer; a != nil {
+		switch {
+		case a.JWT != nil:
+			p := claimsPrincipal(PrincipalJWT, a.JWT.Claims)
+			if scopes := stringList(a.JWT.Scopes); len(scopes) > 0 {
+				p.Scopes = scopes
+			}
+			return p
+		case a.IAM != nil:
+			return &Principal{
+				Type:      PrincipalIAM,
+				Subject:   a.IAM.UserID,
+				AccountID: a.IAM.AccountID,
+				ARN:       a.IAM.UserARN,
+			}
+		case a.Claims != nil:
+			return claimsPrincipal(PrincipalCognito, a.Claims)
+		case a.PrincipalID != "" || a.Lambda != nil:
+			return lambdaPrincipal(a)
+		}
+	}
+	if id := r.RequestContext.Identity; id.UserArn != "" {
+		return &Principal{
+			Type:      PrincipalIAM,
+			Subject:   id.User,
+			AccountID: id.AccountID,
+			ARN:       id.UserArn,
+		}
+	}
+	return nil
+}
+
+// GetPrincipal returns the identity of the caller which issued r, or nil if the request is not authenticated.
+// See Request.Principal for details.
+func GetPrincipal(r *http.Request) *Principal {
+	if req := GetRequest(r); req != nil {
+		return req.Principal()
+	}
+	return nil
+}
+
+// claimsPrincipal returns the principal identified by JWT claims.
+func claimsPrincipal(t PrincipalType, claims jwtclaims.Claims) *Principal {
+	p := &Principal{
+		Type:     t,
+		Subject:  claims.Sub(),
+		Username: claims.Username(),
+		Groups:   claimList(claims[cognitoGroupsClaim]),
+		Scopes:   claimList(claims.Scope()),
+		Claims:   claims,
+	}
+	if p.Username == "" {
+		p.Username = claims[cognitoUsernameClaim]
+	}
+	return p
+}
+
+// lambdaPrincipal returns the principal identified by a Lambda authorizer.
+func lambdaPrincipal(a *Authorizer) *Principal {
+	p := &Principal{
+		Type:    PrincipalLambda,
+		Subject: a.PrincipalID,
+		Context: a.Lambda,
+	}
+	if p.Subject == "" {
+		p.Subject, _ = a.Lambda.String(lambdaPrincipalIDKey)
+	}
+	p.Username, _ = a.Lambda.String(lambdaUsernameKey)
+	p.Groups = contextList(a.Lambda[lambdaGroupsKey])
+	p.Scopes = contextList(a.Lambda[lambdaScopesKey])
+	return p
+}
+
+// contextList returns the list held by a Lambda authorizer context value.
+func contextList(v interface{}) []string {
+	if s, ok := v.(string); ok {
+		return claimList(s)
+	}
+	return stringList(v)
+}
+
+// claimList parses a claim holding a list of values. API Gateway formats lists differently depending on the
+// authorizer: as a JSON array (["a","b"]), space-separated in brackets ([a b]), or comma-separated (a,b).
+func claimList(claim string) []string {
+	claim = strings.TrimSpace(claim)
+	if claim == "" {
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(claim), &list); err == nil {
+		return list
+	}
+	claim = strings.TrimSuffix(strings.TrimPrefix(claim, "["), "]")
+	return strings.FieldsFunc(claim, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// stringList returns the strings held by v, which is either a []string or a []interface{} decoded from JSON.
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
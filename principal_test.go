@@ -0,0 +1,236 @@
+package lambada
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/rajarathnabalan/lambada/jwtclaims"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrincipal(t *testing.T) {
+	cases := []struct {
+		name     string
+		event    string
+		expected *Principal
+	}{
+		{
+			name: "v1 cognito",
+			event: `{"httpMethod":"GET","path":"/","requestContext":{"authorizer":{"claims":{
+				"sub":"5f1c","cognito:username":"jdoe","cognito:groups":"admin,users","email":"j@doe.com"}}}}`,
+			expected: &Principal{
+				Type:     PrincipalCognito,
+				Subject:  "5f1c",
+				Username: "jdoe",
+				Groups:   []string{"admin", "users"},
+				Claims:   jwtclaims.Claims{"sub": "5f1c", "cognito:username": "jdoe", "cognito:groups": "admin,users", "email": "j@doe.com"},
+			},
+		},
+		{
+			name: "v1 cognito non-string claims",
+			event: `{"httpMethod":"GET","path":"/","requestContext":{"authorizer":{"claims":{
+				"sub":"5f1c","cognito:groups":["admin","users"],"email_verified":true}}}}`,
+			expected: &Principal{
+				Type:    PrincipalCognito,
+				Subject: "5f1c",
+				Groups:  []string{"admin", "users"},
+				Claims:  jwtclaims.Claims{"sub": "5f1c", "cognito:groups": `["admin","users"]`, "email_verified": "true"},
+			},
+		},
+		{
+			name: "v1 iam",
+			event: `{"httpMethod":"GET","path":"/","requestContext":{"identity":{
+				"accountId":"123456789012","user":"AIDACKCEVSQ6C2EXAMPLE","userArn":"arn:aws:iam::123456789012:user/jdoe"}}}`,
+			expected: &Principal{
+				Type:      PrincipalIAM,
+				Subject:   "AIDACKCEVSQ6C2EXAMPLE",
+				AccountID: "123456789012",
+				ARN:       "arn:aws:iam::123456789012:user/jdoe",
+			},
+		},
+		{
+			name: "v2 jwt",
+			event: `{"version":"2.0","rawPath":"/","requestContext":{"http":{"method":"GET"},"authorizer":{"jwt":{
+				"claims":{"sub":"5f1c","username":"jdoe","cognito:groups":"[admin users]","scope":"openid"},
+				"scopes":["items/read","items/write"]}}}}`,
+			expected: &Principal{
+				Type:     PrincipalJWT,
+				Subject:  "5f1c",
+				Username: "jdoe",
+				Groups:   []string{"admin", "users"},
+				Scopes:   []string{"items/read", "items/write"},
+				Claims:   jwtclaims.Claims{"sub": "5f1c", "username": "jdoe", "cognito:groups": "[admin users]", "scope": "openid"},
+			},
+		},
+		{
+			name: "v2 jwt scope claim",
+			event: `{"version":"2.0","rawPath":"/","requestContext":{"http":{"method":"GET"},"authorizer":{"jwt":{
+				"claims":{"sub":"5f1c","scope":"items/read items/write"},"scopes":null}}}}`,
+			expected: &Principal{
+				Type:    PrincipalJWT,
+				Subject: "5f1c",
+				Scopes:  []string{"items/read", "items/write"},
+				Claims:  jwtclaims.Claims{"sub": "5f1c", "scope": "items/read items/write"},
+			},
+		},
+		{
+			name: "v2 iam",
+			event: `{"version":"2.0","rawPath":"/","requestContext":{"http":{"method":"GET"},"authorizer":{"iam":{
+				"accountId":"123456789012","userId":"AIDACKCEVSQ6C2EXAMPLE","userArn":"arn:aws:iam::123456789012:user/jdoe"}}}}`,
+			expected: &Principal{
+				Type:      PrincipalIAM,
+				Subject:   "AIDACKCEVSQ6C2EXAMPLE",
+				AccountID: "123456789012",
+				ARN:       "arn:aws:iam::123456789012:user/jdoe",
+			},
+		},
+		{
+			name:  "anonymous",
+			event: `{"httpMethod":"GET","path":"/","requestContext":{"identity":{"sourceIp":"1.2.3.4"}}}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var req Request
+			require.NoError(t, json.Unmarshal([]byte(c.event), &req))
+			assert.Equal(t, c.expected, req.Principal())
+
+			var principal *Principal
+			h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal = GetPrincipal(r)
+			}))
+			_, err := h(context.Background(), req)
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, principal)
+		})
+	}
+}
+
+func TestPrincipalGroupsAndScopes(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &Principal{Groups: []string{"admin"}, Scopes: []string{"items/read"}}
+	assert.True(p.HasGroup("admin"))
+	assert.False(p.HasGroup("users"))
+	assert.True(p.HasScope("items/read"))
+	assert.False(p.HasScope("items/write"))
+
+	var anonymous *Principal
+	assert.False(anonymous.HasGroup("admin"))
+	assert.False(anonymous.HasScope("items/read"))
+}
+
+func TestAuthorizerUnmarshalJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	// Values which are not claims objects are ignored
+	var a Authorizer
+	require.NoError(t, json.Unmarshal([]byte(`{"claims":"not claims","jwt":{"claims":{"sub":"a"}}}`), &a))
+	assert.Nil(a.Claims)
+	assert.Equal("a", a.JWT.Claims.Sub())
+
+	require.Error(t, json.Unmarshal([]byte(`{"jwt":"invalid"}`), &a))
+}
+
+func TestLambdaAuthorizer(t *testing.T) {
+	cases := []struct {
+		fixture     string
+		principalID string
+		number      interface{}
+		boolean     interface{}
+	}{
+		{fixture: "testdata/lambda-authorizer-v1.json", principalID: "user|a1b2c3d4", number: "123", boolean: "true"},
+		{fixture: "testdata/lambda-authorizer-v2.json", number: json.Number("123"), boolean: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.fixture, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			data, err := os.ReadFile(c.fixture)
+			require.NoError(err)
+			var req Request
+			require.NoError(json.Unmarshal(data, &req))
+
+			a := req.RequestContext.Authorizer
+			require.NotNil(a)
+			assert.Equal(c.principalID, a.PrincipalID)
+			assert.Equal(c.number, a.Lambda["numberKey"])
+			assert.Equal(c.boolean, a.Lambda["booleanKey"])
+			assert.NotContains(a.Lambda, "integrationLatency")
+
+			s, ok := a.Lambda.String("stringKey")
+			assert.True(ok)
+			assert.Equal("value", s)
+			s, ok = a.Lambda.String("numberKey")
+			assert.True(ok)
+			assert.Equal("123", s)
+			i, ok := a.Lambda.Int64("numberKey")
+			assert.True(ok)
+			assert.Equal(int64(123), i)
+			f, ok := a.Lambda.Float64("numberKey")
+			assert.True(ok)
+			assert.Equal(123.0, f)
+			b, ok := a.Lambda.Bool("booleanKey")
+			assert.True(ok)
+			assert.True(b)
+			_, ok = a.Lambda.Int64("stringKey")
+			assert.False(ok)
+			_, ok = a.Lambda.String("missing")
+			assert.False(ok)
+
+			p := req.Principal()
+			require.NotNil(p)
+			assert.Equal(PrincipalLambda, p.Type)
+			assert.Equal("user|a1b2c3d4", p.Subject)
+			assert.Equal("jdoe", p.Username)
+			assert.Equal([]string{"admin", "users"}, p.Groups)
+			assert.Equal(a.Lambda, p.Context)
+
+			// The event is encoded back using the same format
+			encoded, err := json.Marshal(req)
+			require.NoError(err)
+			var expected, actual map[string]interface{}
+			require.NoError(json.Unmarshal(data, &expected))
+			require.NoError(json.Unmarshal(encoded, &actual))
+			assert.Equal(
+				expected["requestContext"].(map[string]interface{})["authorizer"],
+				actual["requestContext"].(map[string]interface{})["authorizer"],
+			)
+		})
+	}
+}
+
+func TestLambdaAuthorizerContext(t *testing.T) {
+	assert := assert.New(t)
+
+	c := LambdaAuthorizerContext{"float": 1.5, "int": 2, "string": "2.5", "bool": "false", "list": []interface{}{"a"}}
+	f, ok := c.Float64("float")
+	assert.True(ok)
+	assert.Equal(1.5, f)
+	_, ok = c.Int64("float")
+	assert.False(ok)
+	i, ok := c.Int64("int")
+	assert.True(ok)
+	assert.Equal(int64(2), i)
+	f, ok = c.Float64("string")
+	assert.True(ok)
+	assert.Equal(2.5, f)
+	b, ok := c.Bool("bool")
+	assert.True(ok)
+	assert.False(b)
+	_, ok = c.Bool("string")
+	assert.False(ok)
+	_, ok = c.String("list")
+	assert.False(ok)
+
+	var nilContext LambdaAuthorizerContext
+	_, ok = nilContext.String("a")
+	assert.False(ok)
+}
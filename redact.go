@@ -0,0 +1,449 @@
+package lambada
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/morelj/httptools/header"
+	"github.com/rajarathnabalan/lambada/jwtclaims"
+)
+
+// Redacted is the value replacing redacted data.
+const Redacted = "REDACTED"
+
+// DefaultRedactedHeaders is the list of the headers redacted by default.
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// redactor redacts sensitive data from events and responses.
+// A nil *redactor leaves events and responses untouched.
+type redactor struct {
+	headers    map[string]struct{}
+	query      map[string]struct{}
+	bodyFields [][]string
+	claims     map[string]struct{}
+	bodyLimit  int
+	skipBinary bool
+}
+
+// newRedactor returns a redactor redacting the given headers.
+func newRedactor(headers []string) *redactor {
+	r := &redactor{}
+	r.addHeaders(headers)
+	return r
+}
+
+func (r *redactor) addHeaders(headers []string) {
+	if r.headers == nil {
+		r.headers = make(map[string]struct{}, len(headers))
+	}
+	for _, h := range headers {
+		r.headers[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+}
+
+// logRedactor returns the redactor applied to the events and responses sent to the loggers, creating it if needed.
+func (o *options) logRedactor() *redactor {
+	if o.redactor == nil {
+		o.redactor = &redactor{}
+	}
+	return o.redactor
+}
+
+// WithRedactedHeaders redacts the values of the given headers (and trailers) from the events and responses sent to the
+// request and response loggers. Cookies are redacted when the Cookie (or Set-Cookie for responses) header is listed.
+// The API key and API key id of the request identity are redacted when the X-Api-Key header is listed, and the IAM
+// access keys of the request identity and authorizer are redacted when the Authorization header is listed.
+// If no headers are given, DefaultRedactedHeaders are redacted.
+func WithRedactedHeaders(headers ...string) Option {
+	if len(headers) == 0 {
+		headers = DefaultRedactedHeaders
+	}
+	return func(o *options) {
+		o.logRedactor().addHeaders(headers)
+	}
+}
+
+// WithRedactedQueryParameters redacts the values of the given query parameters from the events sent to the request
+// logger.
+func WithRedactedQueryParameters(names ...string) Option {
+	return func(o *options) {
+		r := o.logRedactor()
+		if r.query == nil {
+			r.query = make(map[string]struct{}, len(names))
+		}
+		for _, name := range names {
+			r.query[name] = struct{}{}
+		}
+	}
+}
+
+// WithRedactedBodyFields redacts the given fields of the JSON bodies of the events and responses sent to the
+// loggers. Fields are dot-separated paths (e.g. user.password); arrays are traversed, so that items.secret redacts the
+// secret field of every element of the items array.
+// Bodies which are not valid JSON are left untouched. Base64 encoded bodies are only redacted if their Content-Type is a
+// JSON media type.
+func WithRedactedBodyFields(fields ...string) Option {
+	return func(o *options) {
+		r := o.logRedactor()
+		for _, field := range fields {
+			r.bodyFields = append(r.bodyFields, strings.Split(field, "."))
+		}
+	}
+}
+
+// WithRedactedClaims redacts the given JWT and Cognito authorizer claims, and Lambda authorizer context keys, from the
+// events sent to the request logger. The IAM access keys of the request identity and authorizer are redacted as well.
+// The special value * redacts all the claims and context keys.
+func WithRedactedClaims(claims ...string) Option {
+	return func(o *options) {
+		r := o.logRedactor()
+		if r.claims == nil {
+			r.claims = make(map[string]struct{}, len(claims))
+		}
+		for _, claim := range claims {
+			r.claims[claim] = struct{}{}
+		}
+	}
+}
+
+// WithLogBodyLimit truncates the bodies of the events and responses sent to the loggers to limit bytes. Truncated
+// bodies are annotated with their actual size.
+func WithLogBodyLimit(limit int) Option {
+	return func(o *options) {
+		o.logRedactor().bodyLimit = limit
+	}
+}
+
+// WithoutLogBinaryBodies replaces the Base64 encoded bodies of the events and responses sent to the loggers by an
+// annotation containing their size.
+func WithoutLogBinaryBodies() Option {
+	return func(o *options) {
+		o.logRedactor().skipBinary = true
+	}
+}
+
+// redactRequest returns a copy of req with sensitive data redacted.
+// req is left untouched.
+func (r *redactor) redactRequest(req Request) Request {
+	if r == nil {
+		return req
+	}
+	req.Headers = r.redactHeaders(req.Headers)
+	req.MultiValueHeaders = r.redactMultiValueHeaders(req.MultiValueHeaders)
+	if _, ok := r.headers["Cookie"]; ok {
+		req.Cookies = redactCookies(req.Cookies)
+	}
+	if len(r.query) > 0 {
+		req.QueryStringParameters = r.redactQueryParameters(req.QueryStringParameters)
+		req.MultiValueQueryStringParameters = r.redactMultiValueQueryParameters(req.MultiValueQueryStringParameters)
+		req.RawQueryString = r.redactRawQuery(req.RawQueryString)
+	}
+	if _, ok := r.headers["X-Api-Key"]; ok {
+		req.RequestContext.Identity.APIKey = redactString(req.RequestContext.Identity.APIKey)
+		req.RequestContext.Identity.APIKeyID = redactString(req.RequestContext.Identity.APIKeyID)
+	}
+	// IAM access keys are redacted along with the Authorization header (SigV4) and the claims
+	_, accessKeys := r.headers["Authorization"]
+	accessKeys = accessKeys || len(r.claims) > 0
+	if accessKeys {
+		req.RequestContext.Identity.AccessKey = redactString(req.RequestContext.Identity.AccessKey)
+	}
+	if accessKeys && req.RequestContext.Authorizer != nil {
+		authorizer := *req.RequestContext.Authorizer
+		if authorizer.IAM != nil {
+			iam := *authorizer.IAM
+			iam.AccessKey = redactString(iam.AccessKey)
+			authorizer.IAM = &iam
+		}
+		if len(r.claims) > 0 {
+			if authorizer.JWT != nil {
+				jwt := *authorizer.JWT
+				jwt.Claims = r.redactClaims(jwt.Claims)
+				authorizer.JWT = &jwt
+			}
+			authorizer.Claims = r.redactClaims(authorizer.Claims)
+			authorizer.Lambda = r.redactLambdaContext(authorizer.Lambda)
+		}
+		req.RequestContext.Authorizer = &authorizer
+	}
+	req.Body = r.redactBody(req.Body, req.IsBase64Encoded, req.header(header.ContentType))
+	return req
+}
+
+// redactResponse returns a copy of res with sensitive data redacted.
+// res is left untouched.
+func (r *redactor) redactResponse(res Response) Response {
+	if r == nil {
+		return res
+	}
+	res.Headers = r.redactHeaders(res.Headers)
+	res.MultiValueHeaders = r.redactMultiValueHeaders(res.MultiValueHeaders)
+	if _, ok := r.headers["Set-Cookie"]; ok {
+		res.Cookies = redactCookies(res.Cookies)
+	}
+	contentType := res.Headers[header.ContentType]
+	if v := res.MultiValueHeaders[header.ContentType]; len(v) > 0 {
+		contentType = v[0]
+	}
+	res.Body = r.redactBody(res.Body, res.IsBase64Encoded, contentType)
+	return res
+}
+
+func (r *redactor) redactHeaders(h map[string]string) map[string]string {
+	if h == nil {
+		return nil
+	}
+	res := make(map[string]string, len(h))
+	for k, v := range h {
+		if _, ok := r.headers[http.CanonicalHeaderKey(k)]; ok {
+			v = Redacted
+		}
+		res[k] = v
+	}
+	return res
+}
+
+func (r *redactor) redactMultiValueHeaders(h map[string][]string) map[string][]string {
+	if h == nil {
+		return nil
+	}
+	res := make(map[string][]string, len(h))
+	for k, v := range h {
+		if _, ok := r.headers[http.CanonicalHeaderKey(k)]; ok {
+			redacted := make([]string, len(v))
+			for i := range redacted {
+				redacted[i] = Redacted
+			}
+			v = redacted
+		}
+		res[k] = v
+	}
+	return res
+}
+
+// redactString returns Redacted, unless s is empty.
+func redactString(s string) string {
+	if s == "" {
+		return s
+	}
+	return Redacted
+}
+
+// redactCookies returns a copy of cookies with the cookie values (and attributes) redacted.
+func redactCookies(cookies []string) []string {
+	if cookies == nil {
+		return nil
+	}
+	res := make([]string, len(cookies))
+	for i, cookie := range cookies {
+		name, _, _ := strings.Cut(cookie, "=")
+		res[i] = name + "=" + Redacted
+	}
+	return res
+}
+
+func (r *redactor) redactQueryParameters(q map[string]string) map[string]string {
+	if q == nil {
+		return nil
+	}
+	res := make(map[string]string, len(q))
+	for k, v := range q {
+		if _, ok := r.query[k]; ok {
+			v = Redacted
+		}
+		res[k] = v
+	}
+	return res
+}
+
+func (r *redactor) redactMultiValueQueryParameters(q map[string][]string) map[string][]string {
+	if q == nil {
+		return nil
+	}
+	res := make(map[string][]string, len(q))
+	for k, v := range q {
+		if _, ok := r.query[k]; ok {
+			redacted := make([]string, len(v))
+			for i := range redacted {
+				redacted[i] = Redacted
+			}
+			v = redacted
+		}
+		res[k] = v
+	}
+	return res
+}
+
+// redactRawQuery redacts a raw query string, preserving the order and the encoding of the parameters.
+func (r *redactor) redactRawQuery(query string) string {
+	if query == "" {
+		return query
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		k, _, _ := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(k)
+		if err != nil {
+			name = k
+		}
+		if _, ok := r.query[name]; ok {
+			params[i] = k + "=" + Redacted
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func (r *redactor) redactClaims(claims jwtclaims.Claims) jwtclaims.Claims {
+	if claims == nil {
+		return nil
+	}
+	_, all := r.claims["*"]
+	res := make(jwtclaims.Claims, len(claims))
+	for k, v := range claims {
+		if _, ok := r.claims[k]; ok || all {
+			v = Redacted
+		}
+		res[k] = v
+	}
+	return res
+}
+
+// redactLambdaContext redacts the keys of a Lambda authorizer context listed in r.claims.
+func (r *redactor) redactLambdaContext(c LambdaAuthorizerContext) LambdaAuthorizerContext {
+	if c == nil {
+		return nil
+	}
+	_, all := r.claims["*"]
+	res := make(LambdaAuthorizerContext, len(c))
+	for k, v := range c {
+		if _, ok := r.claims[k]; ok || all {
+			v = Redacted
+		}
+		res[k] = v
+	}
+	return res
+}
+
+// redactBody redacts the JSON fields of a body, then applies the binary body and size limits.
+// Base64 encoded bodies are only redacted if contentType is a JSON media type.
+func (r *redactor) redactBody(body string, isBase64 bool, contentType string) string {
+	if body == "" {
+		return body
+	}
+	if isBase64 {
+		if r.skipBinary {
+			return fmt.Sprintf("[binary body, %d bytes]", base64DecodedLen(body))
+		}
+		if len(r.bodyFields) > 0 && isJSONMediaType(contentType) {
+			body = r.redactBase64JSON(body)
+		}
+	} else if len(r.bodyFields) > 0 && isJSONBody(body, contentType) {
+		body = r.redactJSON(body)
+	}
+
+	if r.bodyLimit > 0 && len(body) > r.bodyLimit {
+		// Do not cut UTF-8 sequences
+		limit := r.bodyLimit
+		for limit > 0 && !utf8.RuneStart(body[limit]) {
+			limit--
+		}
+		return fmt.Sprintf("%s...[truncated, %d bytes]", body[:limit], len(body))
+	}
+	return body
+}
+
+// redactJSON redacts the configured fields of a JSON document. If body is not valid JSON, it is returned untouched.
+func (r *redactor) redactJSON(body string) string {
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return body
+	}
+	for _, path := range r.bodyFields {
+		redactJSONPath(doc, path)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return body
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// redactBase64JSON redacts the configured fields of a Base64 encoded JSON document. If body cannot be decoded (e.g.
+// because it is compressed), it is returned untouched.
+func (r *redactor) redactBase64JSON(body string) string {
+	data, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return body
+	}
+	redacted := r.redactJSON(string(data))
+	if redacted == string(data) {
+		return body
+	}
+	return base64.StdEncoding.EncodeToString([]byte(redacted))
+}
+
+// redactTrailers returns a copy of trailers with sensitive values redacted, the same way as headers.
+func (r *redactor) redactTrailers(trailers http.Header) http.Header {
+	if r == nil {
+		return trailers
+	}
+	return r.redactMultiValueHeaders(trailers)
+}
+
+// redactJSONPath replaces the value at path in doc by Redacted. Arrays are traversed.
+func redactJSONPath(doc interface{}, path []string) {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		child, ok := v[path[0]]
+		if !ok {
+			return
+		}
+		if len(path) == 1 {
+			v[path[0]] = Redacted
+		} else {
+			redactJSONPath(child, path[1:])
+		}
+	case []interface{}:
+		for _, item := range v {
+			redactJSONPath(item, path)
+		}
+	}
+}
+
+// isJSONBody returns whether body is likely to be a JSON document.
+func isJSONBody(body, contentType string) bool {
+	if isJSONMediaType(contentType) {
+		return true
+	}
+	trimmed := strings.TrimSpace(body)
+	return strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")
+}
+
+// isJSONMediaType returns whether contentType is a JSON media type.
+func isJSONMediaType(contentType string) bool {
+	mediaType, _ := parseMediaType(contentType)
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// base64DecodedLen returns the size of the data encoded in the Base64 string s.
+func base64DecodedLen(s string) int {
+	n := len(s) / 4 * 3
+	switch {
+	case strings.HasSuffix(s, "=="):
+		n -= 2
+	case strings.HasSuffix(s, "="):
+		n--
+	}
+	return n
+}
@@ -0,0 +1,227 @@
+package lambada
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rajarathnabalan/lambada/jwtclaims"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	r := newOptions(
+		WithRedactedHeaders(),
+		WithRedactedQueryParameters("token", "a b"),
+		WithRedactedClaims("email"),
+		WithRedactedBodyFields("password", "items.secret", "missing.field"),
+	).redactor
+
+	req := Request{
+		Headers:                         map[string]string{"authorization": "Bearer token", "content-type": "application/json"},
+		MultiValueHeaders:               map[string][]string{"Cookie": {"a=1", "b=2"}},
+		Cookies:                         []string{"a=1"},
+		QueryStringParameters:           map[string]string{"token": "secret", "page": "1"},
+		MultiValueQueryStringParameters: map[string][]string{"token": {"s1", "s2"}},
+		RawQueryString:                  "token=secret&page=1&a+b=c",
+		Body:                            `{"name":"item","password":"secret","items":[{"secret":1,"n":1.50}]}`,
+	}
+	req.RequestContext.Authorizer = &Authorizer{
+		JWT:    &JWTAuthorizer{Claims: jwtclaims.Claims{"sub": "user", "email": "a@b.c"}},
+		Claims: jwtclaims.Claims{"email": "a@b.c"},
+		Lambda: LambdaAuthorizerContext{"email": "a@b.c", "tenant": "t1"},
+	}
+
+	res := r.redactRequest(req)
+	assert.Equal(Redacted, res.Headers["authorization"])
+	assert.Equal("application/json", res.Headers["content-type"])
+	assert.Equal([]string{Redacted, Redacted}, res.MultiValueHeaders["Cookie"])
+	assert.Equal([]string{"a=" + Redacted}, res.Cookies)
+	assert.Equal(map[string]string{"token": Redacted, "page": "1"}, res.QueryStringParameters)
+	assert.Equal([]string{Redacted, Redacted}, res.MultiValueQueryStringParameters["token"])
+	assert.Equal("token="+Redacted+"&page=1&a+b="+Redacted, res.RawQueryString)
+	assert.Equal(jwtclaims.Claims{"sub": "user", "email": Redacted}, res.RequestContext.Authorizer.JWT.Claims)
+	assert.Equal(jwtclaims.Claims{"email": Redacted}, res.RequestContext.Authorizer.Claims)
+	assert.Equal(LambdaAuthorizerContext{"email": Redacted, "tenant": "t1"}, res.RequestContext.Authorizer.Lambda)
+	assert.JSONEq(`{"name":"item","password":"REDACTED","items":[{"secret":"REDACTED","n":1.50}]}`, res.Body)
+	assert.Contains(res.Body, "1.50")
+
+	// The original request is left untouched
+	assert.Equal("Bearer token", req.Headers["authorization"])
+	assert.Equal("secret", req.QueryStringParameters["token"])
+	assert.Equal("a@b.c", req.RequestContext.Authorizer.JWT.Claims["email"])
+	assert.Equal("a@b.c", req.RequestContext.Authorizer.Claims["email"])
+	assert.Contains(req.Body, `"password":"secret"`)
+
+	// A nil redactor does nothing
+	assert.Equal(req, (*redactor)(nil).redactRequest(req))
+}
+
+func TestRedactBody(t *testing.T) {
+	cases := []struct {
+		name        string
+		options     []Option
+		body        string
+		isBase64    bool
+		contentType string
+		expected    string
+	}{
+		{name: "empty", options: []Option{WithLogBodyLimit(2)}, body: "", expected: ""},
+		{name: "under limit", options: []Option{WithLogBodyLimit(5)}, body: "Hello", expected: "Hello"},
+		{name: "truncated", options: []Option{WithLogBodyLimit(4)}, body: "Hello", expected: "Hell...[truncated, 5 bytes]"},
+		{name: "utf-8", options: []Option{WithLogBodyLimit(2)}, body: "€uro", expected: "...[truncated, 6 bytes]"},
+		{name: "binary", options: []Option{WithoutLogBinaryBodies()}, body: "AQID", isBase64: true, expected: "[binary body, 3 bytes]"},
+		{name: "binary padding", options: []Option{WithoutLogBinaryBodies()}, body: "AQ==", isBase64: true, expected: "[binary body, 1 bytes]"},
+		{name: "binary kept", options: []Option{WithLogBodyLimit(10)}, body: "AQID", isBase64: true, expected: "AQID"},
+		{name: "invalid json", options: []Option{WithRedactedBodyFields("a")}, body: `{"a":`, expected: `{"a":`},
+		{name: "not json", options: []Option{WithRedactedBodyFields("a")}, body: `a=1`, expected: `a=1`},
+		{
+			name:        "base64 json",
+			options:     []Option{WithRedactedBodyFields("a")},
+			body:        base64.StdEncoding.EncodeToString([]byte(`{"a":"secret","b":1}`)),
+			isBase64:    true,
+			contentType: "application/json; charset=utf-8",
+			expected:    base64.StdEncoding.EncodeToString([]byte(`{"a":"REDACTED","b":1}`)),
+		},
+		{
+			name:     "base64 without content type",
+			options:  []Option{WithRedactedBodyFields("a")},
+			body:     base64.StdEncoding.EncodeToString([]byte(`{"a":"secret"}`)),
+			isBase64: true,
+			expected: base64.StdEncoding.EncodeToString([]byte(`{"a":"secret"}`)),
+		},
+		{
+			name:        "base64 compressed json",
+			options:     []Option{WithRedactedBodyFields("a")},
+			body:        "H4sIAAAAAAAA/w==",
+			isBase64:    true,
+			contentType: "application/json",
+			expected:    "H4sIAAAAAAAA/w==",
+		},
+		{
+			name:     "json then truncated",
+			options:  []Option{WithRedactedBodyFields("a"), WithLogBodyLimit(12)},
+			body:     `{"a":"some long secret","b":"<>"}`,
+			expected: `{"a":"REDACT...[truncated, 25 bytes]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := newOptions(c.options...).redactor
+			assert.Equal(t, c.expected, r.redactBody(c.body, c.isBase64, c.contentType))
+		})
+	}
+}
+
+func TestLoggingRedaction(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	logger := &recordingLogger{}
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"token":"secret"}`))
+	}), WithLogger(logger), WithRedactedHeaders(), WithRedactedBodyFields("token", "password"))
+
+	_, err := h(context.Background(), Request{
+		HTTPMethod: http.MethodPost,
+		Path:       "/",
+		Headers:    map[string]string{"Authorization": "Bearer token"},
+		Body:       `{"password":"secret"}`,
+	})
+	require.NoError(err)
+	require.Len(logger.messages, 2)
+	for _, msg := range logger.messages {
+		assert.NotContains(msg, "secret")
+		assert.NotContains(msg, "Bearer")
+	}
+
+	var res Response
+	require.NoError(json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(logger.messages[1]), "Response: ")), &res))
+	assert.Equal(`{"token":"REDACTED"}`, res.Body)
+	assert.Equal([]string{Redacted}, res.MultiValueHeaders["Set-Cookie"])
+}
+
+func TestDroppedTrailersRedaction(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	logger := &recordingLogger{}
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Authorization, X-Checksum")
+		w.Write([]byte("Hello"))
+		w.Header().Set("Authorization", "secret")
+		w.Header().Set("X-Checksum", "abc")
+	}), WithResponseLogger(logger), WithTrailerMode(DropTrailers), WithRedactedHeaders())
+
+	_, err := h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/"})
+	require.NoError(err)
+	require.Len(logger.messages, 2)
+	assert.True(strings.HasPrefix(logger.messages[0], "Warning: dropped response trailers"))
+	assert.NotContains(logger.messages[0], "secret")
+	assert.Contains(logger.messages[0], "abc")
+}
+
+func TestIdentityRedaction(t *testing.T) {
+	cases := []struct {
+		fixture  string
+		options  []Option
+		redacted []string
+		kept     []string
+	}{
+		{
+			fixture:  "testdata/aws/apigw-request.json",
+			options:  []Option{WithRedactedHeaders()},
+			redacted: []string{"theApiKey", "theApiKeyId", "ANEXAMPLEOFACCESSKEY"},
+		},
+		{
+			fixture:  "testdata/aws/apigw-request.json",
+			options:  []Option{WithRedactedHeaders("X-Api-Key")},
+			redacted: []string{"theApiKey", "theApiKeyId"},
+			kept:     []string{"ANEXAMPLEOFACCESSKEY"},
+		},
+		{
+			fixture: "testdata/aws/apigw-request.json",
+			options: []Option{WithRedactedHeaders("Cookie")},
+			kept:    []string{"theApiKey", "theApiKeyId", "ANEXAMPLEOFACCESSKEY"},
+		},
+		{
+			fixture:  "testdata/aws/lambda-urls-request.json",
+			options:  []Option{WithRedactedClaims("email")},
+			redacted: []string{"AKIA..."},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.fixture, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			data, err := os.ReadFile(c.fixture)
+			require.NoError(err)
+			var req Request
+			require.NoError(json.Unmarshal(data, &req))
+
+			logger := &recordingLogger{}
+			h := NewHandler(http.NotFoundHandler(), append(c.options, WithRequestLogger(logger))...)
+			_, err = h(context.Background(), req)
+			require.NoError(err)
+			require.Len(logger.messages, 1)
+			for _, s := range c.redacted {
+				assert.NotContains(logger.messages[0], `"`+s+`"`)
+			}
+			for _, s := range c.kept {
+				assert.Contains(logger.messages[0], `"`+s+`"`)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+// Package replay replays captured Lambda events through an http.Handler and compares the produced responses against
+// the recorded ones.
+//
+// Events are usually captured using the lambada.WithCapture option. Replay is typically done from a test:
+//
+//	func TestReplay(t *testing.T) {
+//	    replay.Test(t, newHandler(), lambada.WithOutputMode(lambada.Automatic))
+//	}
+//
+// And then run using the lambada replay command:
+//
+//	lambada replay -pkg ./cmd/api events.jsonl
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rajarathnabalan/lambada"
+)
+
+// FileEnv is the name of the environment variable used to pass the file to replay to Test.
+const FileEnv = "LAMBADA_REPLAY_FILE"
+
+// DefaultIgnoredHeaders is the list of the response headers ignored by Test when comparing responses, as their values
+// change on every invocation: the Lambda request id set by lambada.WithRequestID and the timings set by
+// lambada.WithDiagnostics.
+var DefaultIgnoredHeaders = []string{"Date", lambada.LambdaRequestIDHeader, lambada.ServerTimingHeader}
+
+// maxLineSize is the maximum size of a line. Lambda events are limited to 6 MB.
+const maxLineSize = 8 * 1024 * 1024
+
+// Read reads records from r.
+// Each line of r may either be:
+//   - a lambada.CaptureRecord, as written by the lambada.WithCapture option
+//   - a raw Lambda event, in which case the record has no response
+//   - a line logged by the lambada request logger ("Got request: <event>") or response logger ("Response:
+//     <response>"), in which case the response is attached to the previous event. The message may only be preceded
+//     by a log prefix (e.g. a timestamp), which cannot contain JSON.
+//
+// Empty lines and lines not matching any of the above are ignored.
+func Read(r io.Reader) ([]lambada.CaptureRecord, error) {
+	var records []lambada.CaptureRecord
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(text, "{") {
+			var probe map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(text), &probe); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			rec := lambada.CaptureRecord{}
+			var err error
+			if _, ok := probe["event"]; ok {
+				err = json.Unmarshal([]byte(text), &rec)
+			} else {
+				err = json.Unmarshal([]byte(text), &rec.Event)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			records = append(records, rec)
+			continue
+		}
+
+		if event, ok := cutLogMessage(text, "Got request: "); ok {
+			rec := lambada.CaptureRecord{}
+			if err := json.Unmarshal([]byte(event), &rec.Event); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			records = append(records, rec)
+			continue
+		}
+
+		if response, ok := cutLogMessage(text, "Response: "); ok {
+			if len(records) == 0 {
+				continue
+			}
+			res := &lambada.Response{}
+			if err := json.Unmarshal([]byte(response), res); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			records[len(records)-1].Response = res
+		}
+	}
+
+	return records, scanner.Err()
+}
+
+// cutLogMessage returns the JSON document following marker if the message of the logged line starts with marker, i.e.
+// if marker is either at the start of the line, or only preceded by a log prefix ending with a space.
+// The prefix cannot contain JSON, so that markers within logged documents are not matched.
+func cutLogMessage(line, marker string) (string, bool) {
+	prefix, after, ok := strings.Cut(line, marker)
+	if !ok || !strings.HasPrefix(after, "{") {
+		return "", false
+	}
+	if prefix != "" && (!strings.ContainsAny(prefix[len(prefix)-1:], " \t") || strings.ContainsAny(prefix, `{"`)) {
+		return "", false
+	}
+	return after, true
+}
+
+// ReadFile reads records from the named file. See Read.
+func ReadFile(name string) ([]lambada.CaptureRecord, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Compare compares the actual response against the expected one, and returns the list of the differences.
+// Header names are case insensitive, and headers listed in ignoreHeaders are not compared. Values equal to
+// lambada.Redacted in expected match any value.
+func Compare(expected, actual lambada.Response, ignoreHeaders ...string) []string {
+	var diffs []string
+
+	if expected.StatusCode != actual.StatusCode {
+		diffs = append(diffs, fmt.Sprintf("status: expected %d, got %d", expected.StatusCode, actual.StatusCode))
+	}
+
+	ignored := map[string]struct{}{}
+	for _, h := range ignoreHeaders {
+		ignored[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+	expectedHeader, actualHeader := responseHeader(expected), responseHeader(actual)
+	keys := map[string]struct{}{}
+	for k := range expectedHeader {
+		keys[k] = struct{}{}
+	}
+	for k := range actualHeader {
+		keys[k] = struct{}{}
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for k := range keys {
+		if _, ok := ignored[k]; !ok {
+			sortedKeys = append(sortedKeys, k)
+		}
+	}
+	sort.Strings(sortedKeys)
+	for _, k := range sortedKeys {
+		if !valuesMatch(expectedHeader[k], actualHeader[k]) {
+			diffs = append(diffs, fmt.Sprintf("header %s: expected %q, got %q", k, expectedHeader[k], actualHeader[k]))
+		}
+	}
+
+	if !valuesMatch(expected.Cookies, actual.Cookies) {
+		diffs = append(diffs, fmt.Sprintf("cookies: expected %q, got %q", expected.Cookies, actual.Cookies))
+	}
+
+	if expected.IsBase64Encoded != actual.IsBase64Encoded {
+		diffs = append(diffs, fmt.Sprintf("isBase64Encoded: expected %t, got %t", expected.IsBase64Encoded, actual.IsBase64Encoded))
+	}
+	expectedBody, actualBody := responseBody(expected), responseBody(actual)
+	if expectedBody != actualBody {
+		diffs = append(diffs, fmt.Sprintf("body: expected %q, got %q", truncate(expectedBody), truncate(actualBody)))
+	}
+
+	return diffs
+}
+
+// Test replays the file named by the LAMBADA_REPLAY_FILE environment variable through h. If the variable is not set,
+// the test is skipped. See TestFile.
+func Test(t *testing.T, h http.Handler, options ...lambada.Option) {
+	t.Helper()
+	TestIgnoring(t, h, nil, options...)
+}
+
+// TestIgnoring is like Test, but ignores the response headers listed in ignoreHeaders in addition to
+// DefaultIgnoredHeaders. See TestFileIgnoring.
+func TestIgnoring(t *testing.T, h http.Handler, ignoreHeaders []string, options ...lambada.Option) {
+	t.Helper()
+	name := os.Getenv(FileEnv)
+	if name == "" {
+		t.Skipf("%s is not set", FileEnv)
+	}
+	TestFileIgnoring(t, name, h, ignoreHeaders, options...)
+}
+
+// TestFile replays the records of the named file through h, using lambada.NewHandler with the given options.
+// Each record is run as a subtest, which fails if the produced response differs from the recorded one (headers listed
+// in DefaultIgnoredHeaders are ignored), or if the handler returned an error while the recorded invocation did not.
+// Records of invocations which panicked are skipped.
+//
+// Records written by lambada.WithCapture hold redacted events: the handler gets lambada.Redacted in place of the
+// redacted headers and cookies (e.g. "Authorization: REDACTED"), and in place of the credentials and claims of the
+// authorizer. Handlers checking credentials by themselves must be given test credentials (e.g. through a middleware
+// or a stubbed verifier) for such records to replay. Redacted values of the recorded responses match any value.
+func TestFile(t *testing.T, name string, h http.Handler, options ...lambada.Option) {
+	t.Helper()
+	TestFileIgnoring(t, name, h, nil, options...)
+}
+
+// TestFileIgnoring is like TestFile, but ignores the response headers listed in ignoreHeaders in addition to
+// DefaultIgnoredHeaders, e.g. the request id header set by lambada.WithRequestID, which is generated from the Lambda
+// request id when the event has no API Gateway request id (ALB events).
+func TestFileIgnoring(t *testing.T, name string, h http.Handler, ignoreHeaders []string, options ...lambada.Option) {
+	t.Helper()
+
+	records, err := ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := lambada.NewHandler(h, options...)
+	ignored := append(append([]string{}, DefaultIgnoredHeaders...), ignoreHeaders...)
+
+	for i, rec := range records {
+		rec := rec
+		t.Run(fmt.Sprintf("%d", i+1), func(t *testing.T) {
+			if rec.Panic {
+				t.Skip("the recorded invocation panicked")
+			}
+			res, err := handler(context.Background(), rec.Event)
+			switch {
+			case err != nil && rec.Error == "":
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && rec.Error != "":
+				t.Fatalf("expected error %q", rec.Error)
+			case err != nil || rec.Response == nil:
+				return
+			}
+			for _, diff := range Compare(*rec.Response, res, ignored...) {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+// responseHeader returns the headers of res, merging single and multi valued headers.
+func responseHeader(res lambada.Response) http.Header {
+	h := http.Header{}
+	for k, v := range res.Headers {
+		h.Set(k, v)
+	}
+	for k, v := range res.MultiValueHeaders {
+		h[http.CanonicalHeaderKey(k)] = v
+	}
+	return h
+}
+
+// responseBody returns the decoded body of res.
+func responseBody(res lambada.Response) string {
+	if res.IsBase64Encoded {
+		if data, err := base64.StdEncoding.DecodeString(res.Body); err == nil {
+			return string(data)
+		}
+	}
+	return res.Body
+}
+
+// valuesMatch returns whether actual matches expected, where lambada.Redacted matches anything.
+func valuesMatch(expected, actual []string) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	for i := range expected {
+		if expected[i] == actual[i] {
+			continue
+		}
+		name, value, _ := strings.Cut(expected[i], "=")
+		if expected[i] == lambada.Redacted || (value == lambada.Redacted && strings.HasPrefix(actual[i], name+"=")) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func truncate(s string) string {
+	const maxLen = 256
+	if len(s) > maxLen {
+		return s[:maxLen] + "..."
+	}
+	return s
+}
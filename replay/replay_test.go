@@ -0,0 +1,143 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rajarathnabalan/lambada"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var helloHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("Hello, " + r.URL.Query().Get("name")))
+})
+
+func TestRead(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	input := strings.Join([]string{
+		`{"event":{"httpMethod":"GET","path":"/a"},"response":{"statusCode":200,"body":"a"}}`,
+		``,
+		`{"httpMethod":"GET","path":"/b"}`,
+		`2023/01/01 00:00:00 Got request: {"httpMethod":"GET","path":"/c"}`,
+		`2023/01/01 00:00:00 Response: {"statusCode":404,"body":"c"}`,
+		`some unrelated line`,
+		`{"event":{"httpMethod":"POST","path":"/d","body":"Got request: {}"},"response":{"statusCode":200,"body":"Response: {}"}}`,
+		`{"event":{"httpMethod":"GET","path":"/e"},"panic":true}`,
+		`2023-01-01T00:00:00.000Z	c0ffee	Got request: {"httpMethod":"GET","path":"/f"}`,
+		`Error: Response: timeout`,
+	}, "\n")
+
+	records, err := Read(strings.NewReader(input))
+	require.NoError(err)
+	require.Len(records, 6)
+	assert.Equal("/a", records[0].Event.Path)
+	assert.Equal("a", records[0].Response.Body)
+	assert.Equal("/b", records[1].Event.Path)
+	assert.Nil(records[1].Response)
+	assert.Equal("/c", records[2].Event.Path)
+	assert.Equal(http.StatusNotFound, records[2].Response.StatusCode)
+	// Log markers within JSON documents are ignored
+	assert.Equal("/d", records[3].Event.Path)
+	assert.Equal("Response: {}", records[3].Response.Body)
+	assert.True(records[4].Panic)
+	assert.Equal("/f", records[5].Event.Path)
+	assert.Nil(records[5].Response)
+
+	_, err = Read(strings.NewReader(`{"invalid`))
+	assert.Error(err)
+}
+
+func TestCompare(t *testing.T) {
+	assert := assert.New(t)
+
+	expected := lambada.Response{
+		StatusCode:        http.StatusOK,
+		MultiValueHeaders: map[string][]string{"Content-Type": {"text/plain"}, "Date": {"yesterday"}, "Set-Cookie": {lambada.Redacted}},
+		Cookies:           []string{"a=" + lambada.Redacted},
+		Body:              "SGVsbG8=",
+		IsBase64Encoded:   true,
+	}
+	actual := lambada.Response{
+		StatusCode:        http.StatusOK,
+		Headers:           map[string]string{"content-type": "text/plain", "date": "today", "set-cookie": "s=1"},
+		MultiValueHeaders: map[string][]string{"Set-Cookie": {"s=1"}},
+		Cookies:           []string{"a=1"},
+		Body:              "SGVsbG8=",
+		IsBase64Encoded:   true,
+	}
+	assert.Empty(Compare(expected, actual, "Date"))
+	assert.Len(Compare(expected, actual), 1)
+
+	actual.StatusCode = http.StatusNotFound
+	actual.Body = "SGk="
+	actual.Cookies = []string{"b=1"}
+	assert.Len(Compare(expected, actual, "Date"), 3)
+}
+
+func TestTestFile(t *testing.T) {
+	require := require.New(t)
+
+	// Capture some events
+	var buf bytes.Buffer
+	h := lambada.NewHandler(helloHandler, lambada.WithCapture(&buf))
+	for _, name := range []string{"alice", "bob"} {
+		_, err := h(context.Background(), lambada.Request{
+			HTTPMethod:            http.MethodGet,
+			Path:                  "/",
+			QueryStringParameters: map[string]string{"name": name},
+		})
+		require.NoError(err)
+	}
+
+	// Invocations which panicked are skipped
+	buf.WriteString(`{"event":{"httpMethod":"GET","path":"/","queryStringParameters":{"name":"panic"}},"panic":true}` + "\n")
+
+	name := filepath.Join(t.TempDir(), "events.jsonl")
+	require.NoError(os.WriteFile(name, buf.Bytes(), 0o600))
+
+	os.Setenv(FileEnv, name)
+	defer os.Unsetenv(FileEnv)
+	Test(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") == "panic" {
+			panic("boom")
+		}
+		helloHandler(w, r)
+	}))
+}
+
+func TestTestFileIgnoring(t *testing.T) {
+	require := require.New(t)
+
+	// Responses holding per-invocation values
+	invocations := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		invocations++
+		w.Header().Set("X-Nonce", strconv.Itoa(invocations))
+		w.Header().Set(lambada.ServerTimingHeader, "handler;dur="+strconv.Itoa(invocations))
+		helloHandler(w, r)
+	})
+
+	var buf bytes.Buffer
+	_, err := lambada.NewHandler(h, lambada.WithCapture(&buf))(context.Background(), lambada.Request{
+		HTTPMethod:            http.MethodGet,
+		Path:                  "/",
+		QueryStringParameters: map[string]string{"name": "alice"},
+	})
+	require.NoError(err)
+
+	name := filepath.Join(t.TempDir(), "events.jsonl")
+	require.NoError(os.WriteFile(name, buf.Bytes(), 0o600))
+
+	TestFileIgnoring(t, name, h, []string{"x-nonce"})
+	require.Equal(2, invocations)
+}
@@ -0,0 +1,133 @@
+package lambada
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+const (
+	// DefaultRequestIDHeader is the default header holding the request id, used by WithRequestID.
+	DefaultRequestIDHeader = "X-Request-Id"
+
+	// LambdaRequestIDHeader is the response header holding the Lambda request id, set by WithRequestID.
+	LambdaRequestIDHeader = "X-Lambda-Request-Id"
+)
+
+// maxRequestIDLen is the maximum length of the request ids accepted from the request headers.
+const maxRequestIDLen = 200
+
+// WithRequestID enables the propagation of correlation ids. The request id of every invocation is:
+//   - the value of the header request header, if set and valid (at most 200 printable ASCII characters),
+//   - or the API Gateway request id (RequestContext.RequestID),
+//   - or the Lambda request id (e.g. for ALB events).
+//
+// The request id is set in the header request and response headers, and the Lambda request id is set in the
+// X-Lambda-Request-Id response header. Both are available to the handler using GetRequestID and GetLambdaRequestID,
+// and are used by the access logs and metrics.
+// If header is empty, DefaultRequestIDHeader is used.
+func WithRequestID(header string) Option {
+	return func(o *options) {
+		if header == "" {
+			header = DefaultRequestIDHeader
+		}
+		o.requestIDHeader = http.CanonicalHeaderKey(header)
+	}
+}
+
+// requestIDs are the correlation ids of an invocation.
+type requestIDs struct {
+	requestID       string
+	lambdaRequestID string
+}
+
+type requestIDKeyType struct{}
+
+var requestIDKey = requestIDKeyType{}
+
+// withRequestIDs resolves the correlation ids of the invocation of event and attaches them to ctx.
+func withRequestIDs(ctx context.Context, header string, event *Request) (context.Context, requestIDs) {
+	var ids requestIDs
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		ids.lambdaRequestID = lc.AwsRequestID
+	}
+	ids.requestID = event.header(header)
+	if !validRequestID(ids.requestID) {
+		ids.requestID = event.RequestContext.RequestID
+	}
+	if ids.requestID == "" {
+		ids.requestID = ids.lambdaRequestID
+	}
+	return context.WithValue(ctx, requestIDKey, ids), ids
+}
+
+// validRequestID returns whether id can be used as a request id.
+// Control characters and non-ASCII characters are rejected, so that request ids can safely be logged and sent back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x20 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDFromContext returns the request id attached to ctx, or an empty string if none (see WithRequestID).
+func RequestIDFromContext(ctx context.Context) string {
+	ids, _ := ctx.Value(requestIDKey).(requestIDs)
+	return ids.requestID
+}
+
+// LambdaRequestIDFromContext returns the Lambda request id of the invocation which issued ctx, or an empty string if
+// unknown. Unlike RequestIDFromContext, it does not require WithRequestID to be enabled.
+func LambdaRequestIDFromContext(ctx context.Context) string {
+	if ids, ok := ctx.Value(requestIDKey).(requestIDs); ok {
+		return ids.lambdaRequestID
+	}
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		return lc.AwsRequestID
+	}
+	return ""
+}
+
+// GetRequestID returns the request id of the invocation which issued r, or an empty string if WithRequestID is not
+// enabled.
+func GetRequestID(r *http.Request) string {
+	return RequestIDFromContext(r.Context())
+}
+
+// GetLambdaRequestID returns the Lambda request id of the invocation which issued r.
+func GetLambdaRequestID(r *http.Request) string {
+	return LambdaRequestIDFromContext(r.Context())
+}
+
+// RequestIDFields returns the requestId and lambdaRequestId fields of the invocation which issued ctx, to be added to
+// the records of a FieldLogger. Empty ids are omitted.
+func RequestIDFields(ctx context.Context) []Field {
+	var fields []Field
+	if id := RequestIDFromContext(ctx); id != "" {
+		fields = append(fields, Field{"requestId", id})
+	}
+	if id := LambdaRequestIDFromContext(ctx); id != "" {
+		fields = append(fields, Field{"lambdaRequestId", id})
+	}
+	return fields
+}
+
+// setRequestIDHeaders sets the correlation headers of r and w.
+// The request header is only set when missing or invalid, the response headers are always set.
+func setRequestIDHeaders(header string, ids requestIDs, r *http.Request, w http.ResponseWriter) {
+	if ids.requestID != "" {
+		if !validRequestID(r.Header.Get(header)) {
+			r.Header.Set(header, ids.requestID)
+		}
+		w.Header().Set(header, ids.requestID)
+	}
+	if ids.lambdaRequestID != "" {
+		w.Header().Set(LambdaRequestIDHeader, ids.lambdaRequestID)
+	}
+}
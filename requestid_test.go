@@ -0,0 +1,102 @@
+package lambada
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID(t *testing.T) {
+	var requestID, lambdaRequestID, header string
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID, lambdaRequestID = GetRequestID(r), GetLambdaRequestID(r)
+		header = r.Header.Get("X-Correlation-Id")
+	}), WithRequestID("x-correlation-id"))
+
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "lambda-id"})
+	v1 := func(headers map[string]string) Request {
+		req := Request{HTTPMethod: http.MethodGet, Path: "/", Headers: headers}
+		req.RequestContext.RequestID = "apigw-id"
+		return req
+	}
+
+	cases := []struct {
+		name     string
+		ctx      context.Context
+		req      Request
+		expected string
+	}{
+		{name: "header", ctx: ctx, req: v1(map[string]string{"X-Correlation-Id": "client-id"}), expected: "client-id"},
+		{name: "api gateway", ctx: ctx, req: v1(nil), expected: "apigw-id"},
+		{name: "invalid header", ctx: ctx, req: v1(map[string]string{"X-Correlation-Id": "a\x01b"}), expected: "apigw-id"},
+		{name: "too long header", ctx: ctx, req: v1(map[string]string{"X-Correlation-Id": strings.Repeat("a", 201)}), expected: "apigw-id"},
+		{name: "lambda", ctx: ctx, req: Request{HTTPMethod: http.MethodGet, Path: "/"}, expected: "lambda-id"},
+		{name: "none", ctx: context.Background(), req: Request{HTTPMethod: http.MethodGet, Path: "/"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			res, err := h(c.ctx, c.req)
+			require.NoError(t, err)
+			assert.Equal(c.expected, requestID)
+			assert.Equal(c.expected, header)
+			assert.Equal(c.expected, res.Headers["X-Correlation-Id"])
+
+			_, withLambda := lambdacontext.FromContext(c.ctx)
+			if withLambda {
+				assert.Equal("lambda-id", lambdaRequestID)
+				assert.Equal("lambda-id", res.Headers[LambdaRequestIDHeader])
+			} else {
+				assert.Empty(lambdaRequestID)
+				assert.NotContains(res.Headers, LambdaRequestIDHeader)
+			}
+		})
+	}
+}
+
+func TestRequestIDDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	var requestID, lambdaRequestID string
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID, lambdaRequestID = GetRequestID(r), GetLambdaRequestID(r)
+	}))
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "lambda-id"})
+	res, err := h(ctx, Request{HTTPMethod: http.MethodGet, Path: "/"})
+	require.NoError(t, err)
+	assert.Empty(requestID)
+	assert.Equal("lambda-id", lambdaRequestID)
+	assert.NotContains(res.Headers, DefaultRequestIDHeader)
+	assert.NotContains(res.Headers, LambdaRequestIDHeader)
+}
+
+func TestRequestIDLogging(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	var fields []Field
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fields = RequestIDFields(r.Context())
+	}), WithRequestID(""), WithAccessLog(NewAccessLogWriter(&buf, AccessLogJSON)))
+
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "lambda-id"})
+	req := Request{HTTPMethod: http.MethodGet, Path: "/", Headers: map[string]string{"x-request-id": "client-id"}}
+	req.RequestContext.RequestID = "apigw-id"
+	_, err := h(ctx, req)
+	require.NoError(t, err)
+
+	assert.Equal([]Field{{"requestId", "client-id"}, {"lambdaRequestId", "lambda-id"}}, fields)
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal("client-id", record["requestId"])
+	assert.Equal("lambda-id", record["lambdaRequestId"])
+}
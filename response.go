@@ -2,15 +2,17 @@ package lambada
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
 	"strconv"
 
 	"github.com/morelj/httptools/header"
 )
 
 // ResponseWriter is an implementation of http.ResponseWriter which stores the data written to it internally.
-// Trailers are not supported by this implementation.
+// As API Gateway does not support trailers, they are delivered according to the TrailerMode (see WithTrailerMode).
 //
 // You usually access ResponseWriter through the http.ResponseWriter interface.
 // If you need to access the underlying ResponseWriter use:
@@ -25,40 +27,85 @@ type ResponseWriter struct {
 	statusCode            int
 	binary                bool
 	ignoreBinaryDetection bool
+	compression           *compression
+	request               *http.Request
+	etag                  bool
+	binDetectors          []binDetector
+	binaryRule            string
+	defaultBinary         bool
+	finalized             bool
+	trailerMode           TrailerMode
+	trailerEncoder        TrailerEncoder
+	trailers              http.Header
+	rpcProtocol           rpcProtocol
+	deadlines             *deadlines
 }
 
+// ErrBodyClosed is returned by ResponseWriter.Write when the response has already been finalized, that is when the
+// http.Handler has already returned.
+var ErrBodyClosed = errors.New("lambada: write on closed response body")
+
 func newResponseWriter(outputMode OutputMode, binary bool) *ResponseWriter {
 	return &ResponseWriter{
-		outputMode: outputMode,
-		header:     http.Header{},
-		binary:     binary,
+		outputMode:    outputMode,
+		header:        http.Header{},
+		binary:        binary,
+		defaultBinary: binary,
+		binaryRule:    BinaryRuleDefault,
+		deadlines:     &deadlines{},
 	}
 }
 
 // Header returns the response's header set.
-// Once the WriteHeader has been called, Header returns a new copy of the response's headers, preventing them from
-// being modified.
+// As with net/http, once WriteHeader has been called, changes to the header map no longer affect the response
+// headers, except for trailers.
 func (w *ResponseWriter) Header() http.Header {
-	if w.statusCode == 0 {
-		return w.header
-	}
-	return w.lockedHeader.Clone()
+	return w.header
 }
 
+// Write writes data to the response body.
+// As with net/http, Write returns http.ErrBodyNotAllowed if the status code does not permit a body (1xx, 204, 304).
+// Writes to a response to a HEAD request are accepted, but the body is discarded when the response is finalized.
+// Once the response has been finalized, Write returns ErrBodyClosed.
+// Once the write deadline has passed (see SetWriteDeadline), Write returns os.ErrDeadlineExceeded.
 func (w *ResponseWriter) Write(data []byte) (int, error) {
+	if err := w.prepareWrite(); err != nil {
+		return 0, err
+	}
+	return w.body.Write(data)
+}
+
+// prepareWrite ensures the header has been written, and returns an error if the body cannot be written.
+func (w *ResponseWriter) prepareWrite() error {
+	if w.finalized {
+		return ErrBodyClosed
+	}
+	if w.deadlines.writeExceeded() {
+		return os.ErrDeadlineExceeded
+	}
 	if w.statusCode == 0 {
 		w.WriteHeader(http.StatusOK)
 	}
-	return w.body.Write(data)
+	if !bodyAllowedForStatus(w.statusCode) {
+		return http.ErrBodyNotAllowed
+	}
+	return nil
 }
 
+// WriteHeader sets the response's status code.
+// Informational status codes (1xx, except 101 Switching Protocols), such as 103 Early Hints, are not final: as API
+// Gateway does not support interim responses, they are ignored and WriteHeader may be called again.
+// Only the first call with a final status code has an effect.
 func (w *ResponseWriter) WriteHeader(statusCode int) {
+	if statusCode < 100 || statusCode >= 600 {
+		panic(fmt.Errorf("invalid status code %d", statusCode))
+	}
+	if statusCode >= 100 && statusCode <= 199 && statusCode != http.StatusSwitchingProtocols {
+		return
+	}
+
 	if w.statusCode == 0 {
 		// WriteHeader has not been called yet
-
-		if statusCode < 100 || statusCode >= 600 {
-			panic(fmt.Errorf("invalid status code %d", statusCode))
-		}
 		w.statusCode = statusCode
 
 		// Current headers are copied into lockedHeader, so further changed to the header map will not affect headers
@@ -71,31 +118,118 @@ func (w *ResponseWriter) finalize() {
 	if w.statusCode == 0 {
 		w.WriteHeader(http.StatusOK)
 	}
+	w.finalized = true
 
 	body := w.body.Bytes()
 
-	// Compute Content-Length
-	w.lockedHeader.Set(header.ContentLength, strconv.FormatInt(int64(len(body)), 10))
+	// Compute Content-Type if not set
+	if w.outputMode >= AutoContentType && len(body) > 0 && w.lockedHeader.Get(header.ContentType) == "" {
+		w.lockedHeader.Set(header.ContentType, http.DetectContentType(body))
+	}
 
-	if w.outputMode >= AutoContentType {
-		// Compute Content-Type if not set
-		if len(body) > 0 && w.lockedHeader.Get(header.ContentType) == "" {
-			w.lockedHeader.Set(header.ContentType, http.DetectContentType(body))
+	if w.rpcProtocol != rpcNone {
+		w.finalizeRPC()
+	} else {
+		w.deliverTrailers()
+	}
+	// Preconditions are evaluated first, so that 304 responses are not compressed for nothing
+	if w.etag {
+		w.setETag()
+		w.checkPreconditions()
+	}
+
+	w.compress()
+
+	switch {
+	case !bodyAllowedForStatus(w.statusCode):
+		// Neither body nor Content-Length for 204 and 304
+		w.body.Reset()
+		delete(w.lockedHeader, header.ContentLength)
+
+	case w.requestMethod() == http.MethodHead:
+		// The Content-Length is the one of the equivalent GET response, unless set explicitly by the handler
+		if w.body.Len() > 0 || w.lockedHeader.Get(header.ContentLength) == "" {
+			w.lockedHeader.Set(header.ContentLength, strconv.Itoa(w.body.Len()))
 		}
+		w.body.Reset()
+
+	default:
+		w.lockedHeader.Set(header.ContentLength, strconv.Itoa(w.body.Len()))
+	}
 
+	if w.outputMode >= AutoContentType {
 		if w.outputMode >= Automatic && !w.ignoreBinaryDetection {
 			// Detect if output is binary
 			// We don't change the mode if we can't determine if the output is binary or not
-			switch isBinary(w.lockedHeader.Get(header.ContentType), w.lockedHeader.Get(header.ContentEncoding)) {
+			status, rule := detectBinary(w.lockedHeader.Get(header.ContentType), w.lockedHeader.Get(header.ContentEncoding), w.binDetectors)
+			switch status {
 			case bsBinary:
 				w.SetBinary(true)
 			case bsText:
 				w.SetBinary(false)
 			}
+			w.binaryRule = rule
 		}
 	}
 }
 
+// compress compresses the body, if compression is enabled and the response is eligible.
+// A compressed response is always sent in binary mode.
+func (w *ResponseWriter) compress() {
+	if w.compression == nil || len(w.compression.encoders) == 0 || w.lockedHeader.Get(header.ContentEncoding) != "" ||
+		!bodyAllowedForStatus(w.statusCode) {
+		return
+	}
+
+	// The response may vary depending on Accept-Encoding, even if it ends up not being compressed for this request
+	contentType := w.lockedHeader.Get(header.ContentType)
+	if w.body.Len() > 0 && isCompressible(contentType) {
+		addVary(w.lockedHeader, header.AcceptEncoding)
+	}
+
+	body, encoding := w.compression.compress(w.body.Bytes(), contentType, w.requestHeader(header.AcceptEncoding))
+	if encoding == "" {
+		return
+	}
+
+	w.body.Reset()
+	w.body.Write(body)
+	w.lockedHeader.Set(header.ContentEncoding, encoding)
+	weakenETag(w.lockedHeader)
+	w.SetBinary(true)
+	w.binaryRule = BinaryRuleContentEncoding
+}
+
+// requestMethod returns the method of the request being answered by w.
+// If the request is unknown, GET is assumed.
+func (w *ResponseWriter) requestMethod() string {
+	if w.request == nil || w.request.Method == "" {
+		return http.MethodGet
+	}
+	return w.request.Method
+}
+
+// requestHeader returns the value of the named header of the request being answered by w.
+func (w *ResponseWriter) requestHeader(name string) string {
+	if w.request == nil {
+		return ""
+	}
+	return w.request.Header.Get(name)
+}
+
+// bodyAllowedForStatus reports whether a response with the given status code may have a body.
+func bodyAllowedForStatus(statusCode int) bool {
+	switch {
+	case statusCode >= 100 && statusCode <= 199:
+		return false
+	case statusCode == http.StatusNoContent:
+		return false
+	case statusCode == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
 // StatusCode returns w's current status code.
 // If WriteHeaders() has not been called yet, returns 200.
 func (w *ResponseWriter) StatusCode() int {
@@ -119,12 +253,39 @@ func (w *ResponseWriter) Body() []byte {
 func (w *ResponseWriter) SetBinary(binary bool) {
 	w.binary = binary
 	w.ignoreBinaryDetection = true
+	w.binaryRule = BinaryRuleForced
+}
+
+// IsBinary returns whether or not the binary mode is currently enabled on w.
+// The binary mode may still change until the response is finalized, if automatic binary detection is enabled.
+func (w *ResponseWriter) IsBinary() bool {
+	return w.binary
+}
+
+// BinaryRule returns the rule which decided whether or not the response is binary.
+// The returned value is either one of BinaryRuleDefault, BinaryRuleForced and BinaryRuleContentEncoding, or the
+// media type pattern which matched the response's Content-Type, prefixed with either "custom:" (for media types
+// registered using WithBinaryMediaTypes or WithTextMediaTypes) or "builtin:" (e.g. builtin:text/*).
+//
+// The rule is only known once the response has been finalized, that is after the http.Handler has returned. Use
+// DetectBinary to find out how a content type is classified from within the handler, or an Observer to inspect the
+// finalized response.
+func (w *ResponseWriter) BinaryRule() string {
+	return w.binaryRule
+}
+
+// DetectBinary runs the automatic binary detection for the given Content-Type and Content-Encoding, using the media
+// types registered on the handler. It returns whether the response would be binary, and the rule which decided it.
+// Unlike BinaryRule, it can be called before the response is finalized. It does not modify the response.
+func (w *ResponseWriter) DetectBinary(contentType, contentEncoding string) (bool, string) {
+	return resolveBinary(contentType, contentEncoding, w.binDetectors, w.defaultBinary)
 }
 
 // AllowBinaryDetection allows binary detection to happen on w.
 // Automatic binary detection will only happen when the OutputMode is set to Automatic.
 func (w *ResponseWriter) AllowBinaryDetection() {
 	w.ignoreBinaryDetection = false
+	w.binaryRule = BinaryRuleDefault
 }
 
 // SetOutputMode sets the output mode for w.
@@ -136,8 +297,9 @@ func (w *ResponseWriter) SetOutputMode(outputMode OutputMode) {
 // That is, the response will be encoded to Base64 when returned to API Gateway.
 //
 // If the passed ResponseWriter has not been provided by Lambada, this function has no effect.
+// Wrapping response writers are unwrapped as described in GetResponseWriter.
 func SetBinary(w http.ResponseWriter) {
-	if w, ok := w.(*ResponseWriter); ok {
+	if w := GetResponseWriter(w); w != nil {
 		w.SetBinary(true)
 	}
 }
@@ -146,15 +308,17 @@ func SetBinary(w http.ResponseWriter) {
 // That is, the response will be be set to not be encoded to Base64 when returned to API Gateway.
 //
 // If the passed ResponseWriter has not been provided by Lambada, this function has no effect.
+// Wrapping response writers are unwrapped as described in GetResponseWriter.
 func SetText(w http.ResponseWriter) {
-	if w, ok := w.(*ResponseWriter); ok {
+	if w := GetResponseWriter(w); w != nil {
 		w.SetBinary(false)
 	}
 }
 
 // SetOutputMode sets the given output mode to the given ResponseWriter.
+// Wrapping response writers are unwrapped as described in GetResponseWriter.
 func SetOutputMode(w http.ResponseWriter, outputMode OutputMode) {
-	if w, ok := w.(*ResponseWriter); ok {
+	if w := GetResponseWriter(w); w != nil {
 		w.SetOutputMode(outputMode)
 	}
 }
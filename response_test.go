@@ -1,6 +1,7 @@
 package lambada
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -133,3 +134,118 @@ func TestReponseWriterBody(t *testing.T) {
 		})
 	}
 }
+
+func TestResponseWriterBinaryRule(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newResponseWriter(Automatic, false)
+	w.binDetectors = newOptions(WithBinaryMediaTypes("application/x-ndjson")).binDetectors
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Write([]byte("{}\n"))
+	w.finalize()
+	assert.True(w.IsBinary())
+	assert.Equal("custom:application/x-ndjson", w.BinaryRule())
+
+	w = newResponseWriter(Automatic, false)
+	SetText(w)
+	w.Header().Set("Content-Type", "image/png")
+	w.finalize()
+	assert.False(w.IsBinary())
+	assert.Equal(BinaryRuleForced, w.BinaryRule())
+}
+
+func TestResponseWriterHead(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newResponseWriter(AutoContentType, false)
+	w.request = httptest.NewRequest(http.MethodHead, "/", nil)
+	_, err := w.Write([]byte("Hello, World!"))
+	assert.NoError(err)
+	w.finalize()
+	assert.Equal(http.StatusOK, w.statusCode)
+	assert.Equal("13", w.lockedHeader.Get("Content-Length"))
+	assert.NotEqual("", w.lockedHeader.Get("Content-Type"))
+	assert.Empty(w.Body())
+
+	// Explicit Content-Length without body
+	w = newResponseWriter(AutoContentType, false)
+	w.request = httptest.NewRequest(http.MethodHead, "/", nil)
+	w.Header().Set("Content-Length", "42")
+	w.finalize()
+	assert.Equal("42", w.lockedHeader.Get("Content-Length"))
+}
+
+func TestResponseWriterNoBodyStatus(t *testing.T) {
+	for _, statusCode := range []int{http.StatusNoContent, http.StatusNotModified} {
+		t.Run(fmt.Sprintf("%d", statusCode), func(t *testing.T) {
+			assert := assert.New(t)
+
+			w := newResponseWriter(AutoContentType, false)
+			w.Header().Set("Content-Length", "13")
+			w.WriteHeader(statusCode)
+			_, err := w.Write([]byte("Hello, World!"))
+			assert.ErrorIs(err, http.ErrBodyNotAllowed)
+			w.finalize()
+
+			assert.Equal(statusCode, w.statusCode)
+			assert.Empty(w.Body())
+			assert.Equal("", w.lockedHeader.Get("Content-Length"))
+		})
+	}
+}
+
+func TestResponseWriterInformational(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newResponseWriter(AutoContentType, false)
+	w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+	w.WriteHeader(http.StatusEarlyHints)
+	assert.Equal(0, w.statusCode)
+
+	// Headers are still writable
+	w.Header().Set("X-Test", "value")
+	w.WriteHeader(http.StatusCreated)
+	assert.Equal(http.StatusCreated, w.StatusCode())
+	assert.Equal("value", w.lockedHeader.Get("X-Test"))
+}
+
+func TestResponseWriterWriteAfterFinalize(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newResponseWriter(AutoContentType, false)
+	w.Write([]byte("Hello"))
+	w.finalize()
+
+	_, err := w.Write([]byte(", World!"))
+	assert.ErrorIs(err, ErrBodyClosed)
+	assert.Equal([]byte("Hello"), w.Body())
+}
+
+func TestDetectBinary(t *testing.T) {
+	assert := assert.New(t)
+
+	binary, rule := DetectBinary("application/x-ndjson", "", WithBinaryMediaTypes("application/x-ndjson"))
+	assert.True(binary)
+	assert.Equal("custom:application/x-ndjson", rule)
+
+	binary, rule = DetectBinary("text/html", "")
+	assert.False(binary)
+	assert.Equal("builtin:text/*", rule)
+
+	binary, rule = DetectBinary("text/html", "gzip")
+	assert.True(binary)
+	assert.Equal(BinaryRuleContentEncoding, rule)
+
+	binary, rule = DetectBinary("unknown/unknown", "", WithDefaultBinary(true))
+	assert.True(binary)
+	assert.Equal(BinaryRuleDefault, rule)
+
+	// The handler's media types are used before the response is finalized
+	var handlerRule string
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, handlerRule = GetResponseWriter(w).DetectBinary("application/x-ndjson", "")
+	}), WithTextMediaTypes("application/x-ndjson"))
+	_, err := h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/"})
+	assert.NoError(err)
+	assert.Equal("custom:application/x-ndjson", handlerRule)
+}
@@ -0,0 +1,134 @@
+package lambada
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// The following interfaces are implemented by ResponseWriter, making it compatible with http.ResponseController and
+// with middlewares relying on optional interfaces.
+var (
+	_ http.Flusher  = (*ResponseWriter)(nil)
+	_ http.Hijacker = (*ResponseWriter)(nil)
+	_ io.ReaderFrom = (*ResponseWriter)(nil)
+)
+
+// Flush sends the header if it has not been sent yet, as with net/http.
+// As the response is buffered until the http.Handler returns, Flush does nothing else.
+func (w *ResponseWriter) Flush() {
+	w.FlushError()
+}
+
+// FlushError is the same as Flush, but returns ErrBodyClosed if the response has already been finalized.
+// This method is used by http.ResponseController.
+func (w *ResponseWriter) FlushError() error {
+	if w.finalized {
+		return ErrBodyClosed
+	}
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	return nil
+}
+
+// ReadFrom reads data from r until EOF and appends it to the response body.
+// The same rules as Write apply.
+func (w *ResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if err := w.prepareWrite(); err != nil {
+		return 0, err
+	}
+	return w.body.ReadFrom(r)
+}
+
+// Hijack always returns an error wrapping http.ErrNotSupported, as API Gateway does not give access to the underlying
+// connection.
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, fmt.Errorf("lambada: cannot hijack a Lambda response: %w", http.ErrNotSupported)
+}
+
+// SetReadDeadline sets the deadline for reading the request body. Once the deadline has passed, reading the request
+// body returns os.ErrDeadlineExceeded.
+// The deadline is capped by the Lambda invocation deadline. A zero value resets the deadline to the Lambda invocation
+// deadline.
+// This method is used by http.ResponseController.
+func (w *ResponseWriter) SetReadDeadline(deadline time.Time) error {
+	w.deadlines.read = w.deadlines.cap(deadline)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for writing the response. Once the deadline has passed, writing to the response
+// returns os.ErrDeadlineExceeded.
+// The deadline is capped by the Lambda invocation deadline. A zero value resets the deadline to the Lambda invocation
+// deadline.
+// This method is used by http.ResponseController.
+func (w *ResponseWriter) SetWriteDeadline(deadline time.Time) error {
+	w.deadlines.write = w.deadlines.cap(deadline)
+	return nil
+}
+
+// GetResponseWriter returns the Lambada ResponseWriter underlying w.
+// If w is not a *ResponseWriter, it is unwrapped using its Unwrap() http.ResponseWriter method, if any (the same
+// convention as http.ResponseController), until a *ResponseWriter is found.
+//
+// When no Lambada ResponseWriter can be found, GetResponseWriter returns nil.
+func GetResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	for w != nil {
+		switch t := w.(type) {
+		case *ResponseWriter:
+			return t
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// deadlines holds the read and write deadlines of a response.
+type deadlines struct {
+	lambda time.Time
+	read   time.Time
+	write  time.Time
+}
+
+// setLambdaDeadline sets the Lambda invocation deadline, which is also the initial read and write deadline.
+func (d *deadlines) setLambdaDeadline(deadline time.Time) {
+	d.lambda = deadline
+	d.read = deadline
+	d.write = deadline
+}
+
+// cap returns deadline capped by the Lambda invocation deadline.
+func (d *deadlines) cap(deadline time.Time) time.Time {
+	if deadline.IsZero() || (!d.lambda.IsZero() && deadline.After(d.lambda)) {
+		return d.lambda
+	}
+	return deadline
+}
+
+func (d *deadlines) readExceeded() bool {
+	return !d.read.IsZero() && time.Now().After(d.read)
+}
+
+func (d *deadlines) writeExceeded() bool {
+	return !d.write.IsZero() && time.Now().After(d.write)
+}
+
+// deadlineReader is an io.ReadCloser enforcing a read deadline.
+type deadlineReader struct {
+	io.ReadCloser
+	deadlines *deadlines
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	if r.deadlines.readExceeded() {
+		return 0, os.ErrDeadlineExceeded
+	}
+	return r.ReadCloser.Read(p)
+}
@@ -0,0 +1,114 @@
+package lambada
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type wrappingWriter struct {
+	http.ResponseWriter
+}
+
+func (w *wrappingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestResponseController(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newResponseWriter(AutoContentType, false)
+	rc := http.NewResponseController(&wrappingWriter{w})
+
+	w.Header().Set("X-Test", "value")
+	assert.NoError(rc.Flush())
+	assert.Equal(http.StatusOK, w.statusCode)
+	assert.Equal("value", w.lockedHeader.Get("X-Test"))
+
+	_, _, err := rc.Hijack()
+	assert.ErrorIs(err, http.ErrNotSupported)
+
+	assert.NoError(rc.SetWriteDeadline(time.Now().Add(-time.Second)))
+	_, err = w.Write([]byte("Hello"))
+	assert.True(errors.Is(err, os.ErrDeadlineExceeded))
+
+	assert.NoError(rc.SetWriteDeadline(time.Time{}))
+	_, err = w.Write([]byte("Hello"))
+	assert.NoError(err)
+
+	w.finalize()
+	assert.ErrorIs(rc.Flush(), ErrBodyClosed)
+}
+
+func TestResponseWriterReadFrom(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newResponseWriter(AutoContentType, false)
+	n, err := io.Copy(&wrappingWriter{w}, strings.NewReader("Hello, World!"))
+	assert.NoError(err)
+	assert.Equal(int64(13), n)
+	assert.Equal("Hello, World!", string(w.Body()))
+}
+
+func TestDeadlines(t *testing.T) {
+	assert := assert.New(t)
+
+	lambdaDeadline := time.Now().Add(time.Minute)
+	d := &deadlines{}
+	d.setLambdaDeadline(lambdaDeadline)
+	assert.Equal(lambdaDeadline, d.cap(time.Time{}))
+	assert.Equal(lambdaDeadline, d.cap(lambdaDeadline.Add(time.Hour)))
+	assert.Equal(lambdaDeadline.Add(-time.Second), d.cap(lambdaDeadline.Add(-time.Second)))
+
+	r := &deadlineReader{ReadCloser: io.NopCloser(strings.NewReader("data")), deadlines: d}
+	d.read = time.Now().Add(-time.Second)
+	_, err := r.Read(make([]byte, 4))
+	assert.ErrorIs(err, os.ErrDeadlineExceeded)
+}
+
+func TestRequestBodyDeadline(t *testing.T) {
+	cases := []struct {
+		name          string
+		body          string
+		expectNoBody  bool
+		expectWrapped bool
+	}{
+		{name: "empty", expectNoBody: true},
+		{name: "non-empty", body: "Hello", expectWrapped: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var body io.ReadCloser
+			h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body = r.Body
+			}))
+			_, err := h(context.Background(), Request{HTTPMethod: http.MethodPost, Path: "/", Body: c.body})
+			assert.NoError(err)
+			assert.Equal(c.expectNoBody, body == http.NoBody)
+			_, wrapped := body.(*deadlineReader)
+			assert.Equal(c.expectWrapped, wrapped)
+		})
+	}
+}
+
+func TestGetResponseWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newResponseWriter(AutoContentType, false)
+	assert.Same(w, GetResponseWriter(w))
+	assert.Same(w, GetResponseWriter(&wrappingWriter{&wrappingWriter{w}}))
+	assert.Nil(GetResponseWriter(&wrappingWriter{}))
+
+	SetBinary(&wrappingWriter{w})
+	assert.True(w.binary)
+}
@@ -0,0 +1,401 @@
+package lambada
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"testing/quick"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The tests of this file check that requests survive a round-trip through Lambda events: an http.Request is converted
+// into an event the way AWS does (see NewEvent), marshalled to JSON, and converted back by lambada.
+// As both conversions are implemented by lambada, they are also checked against real AWS events (see
+// TestAWSEventRoundTrip).
+//
+// The following discrepancies are known limitations of the event formats, and are excluded from the properties:
+//   - Path, query and header strings which are not valid UTF-8 are altered by the JSON encoding of the event.
+//   - V2 and Function URL events join multi-valued headers with commas, and lambada does not split them back. Only
+//     single values are checked.
+//   - Header values are not trimmed by the emulator, whereas AWS trims leading and trailing whitespace.
+//   - Cookies are only preserved if they are valid according to net/http.
+
+var roundTripFormats = []EventFormat{EventFormatV1, EventFormatV2, EventFormatALB, EventFormatFunctionURL}
+
+var roundTripMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+	http.MethodOptions, "PROPFIND",
+}
+
+// roundTrip converts r into an event of the given format, and back into an http.Request.
+func roundTrip(format EventFormat, r *http.Request) (*http.Request, error) {
+	event, err := NewEvent(r, format)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	var req Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+	return makeRequest(&req)
+}
+
+// makeRequest converts event into an http.Request.
+func makeRequest(event *Request) (*http.Request, error) {
+	if event.Version == "2.0" {
+		return makeV2Request(context.Background(), event)
+	}
+	return makeV1Request(context.Background(), event, nil)
+}
+
+// roundTripInput is a request checked by the round-trip properties.
+type roundTripInput struct {
+	method                  string
+	path                    string
+	queryKey, queryValue    string
+	headerKey, headerValue  string
+	cookieName, cookieValue string
+	body                    []byte
+}
+
+// valid returns whether the input is a valid request for the given format, excluding the known limitations.
+func (in roundTripInput) valid(format EventFormat) bool {
+	if !strings.HasPrefix(in.path, "/") || !utf8.ValidString(in.path) {
+		return false
+	}
+	if in.queryKey == "" || !utf8.ValidString(in.queryKey) || !utf8.ValidString(in.queryValue) {
+		return false
+	}
+	if !isToken(in.headerKey) || !validHeaderValue(in.headerValue) {
+		return false
+	}
+	switch http.CanonicalHeaderKey(in.headerKey) {
+	case "Host", "Cookie", "Content-Type", "Content-Encoding":
+		return false
+	}
+
+	// Only keep cookies net/http is able to parse back
+	r := &http.Request{Header: http.Header{}}
+	r.AddCookie(&http.Cookie{Name: in.cookieName, Value: in.cookieValue})
+	c, err := r.Cookie(in.cookieName)
+	return err == nil && c.Value == in.cookieValue
+}
+
+// request returns the http.Request described by in.
+func (in roundTripInput) request() *http.Request {
+	r, _ := http.NewRequest(in.method, "https://example.com", bytes.NewReader(in.body))
+	r.URL.Path = in.path
+	r.URL.RawQuery = url.Values{in.queryKey: {in.queryValue}}.Encode()
+	r.Header.Set(in.headerKey, in.headerValue)
+	r.AddCookie(&http.Cookie{Name: in.cookieName, Value: in.cookieValue})
+	return r
+}
+
+// check checks that the request described by in survives a round-trip using each format.
+func (in roundTripInput) check(t *testing.T) {
+	for _, format := range roundTripFormats {
+		if !in.valid(format) {
+			continue
+		}
+
+		r, err := roundTrip(format, in.request())
+		if err != nil {
+			t.Fatalf("%s: round-trip failed: %v", format, err)
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("%s: failed to read body: %v", format, err)
+		}
+		cookie, err := r.Cookie(in.cookieName)
+		if err != nil {
+			t.Fatalf("%s: cookie %q not found: %v", format, in.cookieName, err)
+		}
+
+		if r.Method != in.method {
+			t.Errorf("%s: method %q, expected %q", format, r.Method, in.method)
+		}
+		if r.URL.Path != in.path {
+			t.Errorf("%s: path %q, expected %q", format, r.URL.Path, in.path)
+		}
+		if v := r.URL.Query().Get(in.queryKey); v != in.queryValue {
+			t.Errorf("%s: query parameter %q is %q, expected %q", format, in.queryKey, v, in.queryValue)
+		}
+		if v := r.Header.Get(in.headerKey); v != in.headerValue {
+			t.Errorf("%s: header %q is %q, expected %q", format, in.headerKey, v, in.headerValue)
+		}
+		if cookie.Value != in.cookieValue {
+			t.Errorf("%s: cookie %q is %q, expected %q", format, in.cookieName, cookie.Value, in.cookieValue)
+		}
+		if !bytes.Equal(body, in.body) {
+			t.Errorf("%s: body %q, expected %q", format, body, in.body)
+		}
+	}
+}
+
+func FuzzRequestRoundTrip(f *testing.F) {
+	f.Add(uint8(0), "/", "a", "1", "X-Test", "value", "session", "xyz", []byte(nil))
+	f.Add(uint8(2), "/items/1", "name", "hello world", "x-lower", "a, b", "c", "d", []byte(`{"name":"item"}`))
+	f.Add(uint8(3), "/a%2Fb/é", "q", "a&b=c", "Accept", "*/*", "id", "1", []byte{0xff, 0x00, 0xfe})
+	f.Add(uint8(4), "/search", "q", "100%", "X-Empty", "", "token", "a.b.c", []byte("€uro"))
+
+	f.Fuzz(func(t *testing.T, method uint8, path, queryKey, queryValue, headerKey, headerValue, cookieName,
+		cookieValue string, body []byte) {
+		roundTripInput{
+			method:      roundTripMethods[int(method)%len(roundTripMethods)],
+			path:        path,
+			queryKey:    queryKey,
+			queryValue:  queryValue,
+			headerKey:   headerKey,
+			headerValue: headerValue,
+			cookieName:  cookieName,
+			cookieValue: cookieValue,
+			body:        body,
+		}.check(t)
+	})
+}
+
+func FuzzBodyRoundTrip(f *testing.F) {
+	f.Add([]byte("Hello"), false)
+	f.Add([]byte{0xff, 0x00, 0xfe}, true)
+	f.Add([]byte("€uro"), true)
+
+	f.Fuzz(func(t *testing.T, data []byte, isBase64 bool) {
+		// Text bodies which are not valid UTF-8 cannot be represented in JSON events
+		if !isBase64 && !utf8.Valid(data) {
+			return
+		}
+
+		// Bodies are transmitted as JSON strings
+		encoded, err := json.Marshal(bytesToBody(data, isBase64))
+		require.NoError(t, err)
+		var body string
+		require.NoError(t, json.Unmarshal(encoded, &body))
+
+		res, err := bodyToBytes(body, isBase64)
+		require.NoError(t, err)
+		assert.Equal(t, len(data), len(res))
+		assert.True(t, bytes.Equal(data, res))
+	})
+}
+
+func FuzzCanonicalizeHeader(f *testing.F) {
+	f.Add("content-type", "application/json")
+	f.Add("X-CUSTOM-header", "a, b")
+	f.Add("x_underscore", "")
+	f.Add("invalid key", "value")
+
+	f.Fuzz(func(t *testing.T, key, value string) {
+		res := canonicalizeHeader(http.Header{key: {value}})
+		assert.Equal(t, http.Header{http.CanonicalHeaderKey(key): {value}}, res)
+		// Canonicalization is idempotent
+		assert.Equal(t, res, canonicalizeHeader(res))
+
+		single := fromSingleValueHeaders(map[string]string{key: value})
+		assert.Equal(t, res, single)
+		if isToken(key) {
+			assert.Equal(t, value, single.Get(key))
+		}
+	})
+}
+
+func FuzzToURLValues(f *testing.F) {
+	f.Add("a", "1")
+	f.Add("q", "hello world")
+	f.Add("q", "x%20y")
+	f.Add("q", "100%")
+	f.Add("a+b", "a+b")
+
+	f.Fuzz(func(t *testing.T, key, value string) {
+		// Keys and values are kept as-is, unless they must be unescaped
+		assert.Equal(t, url.Values{key: {value}}, toURLValues(map[string]string{key: value}, false))
+		assert.Equal(t, url.Values{key: {value}}, toURLValues(map[string]string{url.QueryEscape(key): url.QueryEscape(value)}, true))
+		assert.Equal(t, url.Values{key: {value}}, unescapeURLValues(map[string][]string{url.QueryEscape(key): {url.QueryEscape(value)}}))
+
+		// Invalid escapes are kept as-is
+		res := toURLValues(map[string]string{key: value}, true)
+		unescaped, err := url.QueryUnescape(value)
+		if err != nil {
+			unescaped = value
+		}
+		assert.Equal(t, []string{unescaped}, res[unescapeQuery(key)])
+	})
+}
+
+func TestBodyRoundTripProperty(t *testing.T) {
+	property := func(data []byte) bool {
+		res, err := bodyToBytes(bytesToBody(data, true), true)
+		return err == nil && bytes.Equal(data, res)
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHeaderRoundTripProperty(t *testing.T) {
+	// Multi-valued headers survive V1 events, in order
+	property := func(values []string) bool {
+		h := http.Header{}
+		for _, v := range values {
+			if !validHeaderValue(v) {
+				return true
+			}
+			h.Add("X-Test", v)
+		}
+		r := &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/"}, Header: h, Body: http.NoBody}
+		res, err := roundTrip(EventFormatV1, r)
+		return err == nil && strings.Join(res.Header.Values("X-Test"), "\n") == strings.Join(values, "\n")
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequestRoundTrip(t *testing.T) {
+	cases := []roundTripInput{
+		{method: http.MethodGet, path: "/", queryKey: "a", queryValue: "1", headerKey: "X-Test", headerValue: "value",
+			cookieName: "session", cookieValue: "xyz"},
+		{method: http.MethodPost, path: "/items/é", queryKey: "q", queryValue: "a b&c=d", headerKey: "x-lower",
+			headerValue: "a, b", cookieName: "c", cookieValue: "d", body: []byte{0xff, 0x00, 0xfe}},
+		{method: http.MethodPut, path: "/search", queryKey: "q", queryValue: "100%", headerKey: "X-Empty",
+			cookieName: "token", cookieValue: "a.b.c", body: []byte("€uro")},
+	}
+	for _, c := range cases {
+		t.Run(c.method+c.path, c.check)
+	}
+}
+
+func TestAWSEventRoundTrip(t *testing.T) {
+	// Events sent by AWS, from the testdata of github.com/aws/aws-lambda-go/events
+	cases := []struct {
+		fixture string
+		format  EventFormat
+	}{
+		{fixture: "testdata/aws/apigw-request.json", format: EventFormatV1},
+		{fixture: "testdata/aws/apigw-v2-request-no-authorizer.json", format: EventFormatV2},
+		{fixture: "testdata/aws/alb-lambda-target-request-headers-only.json", format: EventFormatALB},
+		{fixture: "testdata/aws/lambda-urls-request.json", format: EventFormatFunctionURL},
+	}
+
+	for _, c := range cases {
+		t.Run(c.fixture, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			data, err := os.ReadFile(c.fixture)
+			require.NoError(err)
+			var expected Request
+			require.NoError(json.Unmarshal(data, &expected))
+
+			// The event built by NewEvent from the request decoded by lambada matches the event sent by AWS.
+			// The Host header is excluded: the emulator sets it from the request host, whereas the samples omit it or
+			// use a different domain name.
+			r, err := makeRequest(&expected)
+			require.NoError(err)
+			body, err := io.ReadAll(r.Body)
+			require.NoError(err)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			event, err := NewEvent(r, c.format, WithEmulatorStage(expected.RequestContext.Stage))
+			require.NoError(err)
+
+			assert.Equal(expected.Body, event.Body)
+			assert.Equal(expected.IsBase64Encoded, event.IsBase64Encoded)
+			switch c.format {
+			case EventFormatV2, EventFormatFunctionURL:
+				assert.Equal(expected.RequestContext.HTTP.Method, event.RequestContext.HTTP.Method)
+				assert.Equal(expected.RawPath, event.RawPath)
+				assert.Equal(expected.RawQueryString, event.RawQueryString)
+				assert.Equal(expected.QueryStringParameters, event.QueryStringParameters)
+				assert.Equal(validCookies(expected.Cookies), event.Cookies)
+				assert.Equal(withoutHost(expected.Headers), withoutHost(event.Headers))
+			case EventFormatALB:
+				assert.Equal(expected.HTTPMethod, event.HTTPMethod)
+				assert.Equal(expected.Path, event.Path)
+				assert.Equal(expected.QueryStringParameters, event.QueryStringParameters)
+				assert.Equal(withoutHost(expected.Headers), withoutHost(event.Headers))
+			default:
+				assert.Equal(expected.HTTPMethod, event.HTTPMethod)
+				assert.Equal(expected.Path, event.Path)
+				assert.Equal(expected.MultiValueQueryStringParameters, event.MultiValueQueryStringParameters)
+				expectedHeaders, headers := canonicalizeHeader(expected.MultiValueHeaders), canonicalizeHeader(event.MultiValueHeaders)
+				expectedHeaders.Del("Host")
+				headers.Del("Host")
+				assert.Equal(expectedHeaders, headers)
+			}
+
+			// The request survives the round-trip
+			res, err := makeRequest(event)
+			require.NoError(err)
+			resBody, err := io.ReadAll(res.Body)
+			require.NoError(err)
+			assert.Equal(r.Method, res.Method)
+			assert.Equal(r.URL.String(), res.URL.String())
+			assert.Equal(r.Host, res.Host)
+			r.Header.Del("Host")
+			res.Header.Del("Host")
+			assert.Equal(r.Header, res.Header)
+			assert.Equal(body, resBody)
+		})
+	}
+}
+
+// withoutHost returns a copy of h without the host header.
+func withoutHost(h map[string]string) map[string]string {
+	res := make(map[string]string, len(h))
+	for k, v := range h {
+		if !strings.EqualFold(k, "Host") {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// validCookies returns the cookies of a V2 event which are kept by lambada, i.e. the ones having a name and a value.
+func validCookies(cookies []string) []string {
+	var res []string
+	for _, c := range cookies {
+		if strings.Contains(c, "=") {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// isToken returns whether s is a valid HTTP token (RFC 9110), as used in header names.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 0x80 || c <= ' ' || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) >= 0 || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// validHeaderValue returns whether s is a valid, trimmed, header value.
+func validHeaderValue(s string) bool {
+	if !utf8.ValidString(s) || strings.TrimSpace(s) != s {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,605 @@
+// Package runtimeapi provides an emulator of the AWS Lambda Runtime API, allowing black-box tests of functions built
+// with lambada, entirely offline.
+//
+// The emulator either spawns the function binary itself (see Server.Start), or lets an external process connect to it
+// using the environment returned by Server.Env. Events are then fed using Server.Invoke:
+//
+//	func TestFunction(t *testing.T) {
+//	    srv, err := runtimeapi.NewServer(runtimeapi.WithTimeout(time.Second))
+//	    require.NoError(t, err)
+//	    defer srv.Close()
+//	    require.NoError(t, srv.Start("./bin/api"))
+//
+//	    event, _ := lambadatest.V2(http.MethodGet, "/items").Build()
+//	    res, err := srv.Invoke(context.Background(), event)
+//	    require.NoError(t, err)
+//	    require.Nil(t, res.Error)
+//	    ...
+//	}
+//
+// As in Lambda, the execution environment is reset after a timeout or a crash: the process is killed and a new one is
+// started on the next invocation, which is reported as a cold start.
+package runtimeapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/rajarathnabalan/lambada"
+)
+
+const (
+	// DefaultTimeout is the default function timeout, which is the same as in Lambda.
+	DefaultTimeout = 3 * time.Second
+
+	// DefaultFunctionName is the default name of the emulated function.
+	DefaultFunctionName = "lambada"
+
+	// ErrorTypeTimeout is the type of the errors reported when an invocation times out.
+	ErrorTypeTimeout = "Sandbox.Timedout"
+
+	// ErrorTypeExit is the type of the errors reported when the function process exits during an invocation.
+	ErrorTypeExit = "Runtime.ExitError"
+)
+
+// Runtime API headers
+const (
+	headerRequestID   = "Lambda-Runtime-Aws-Request-Id"
+	headerDeadline    = "Lambda-Runtime-Deadline-Ms"
+	headerFunctionARN = "Lambda-Runtime-Invoked-Function-Arn"
+	headerTraceID     = "Lambda-Runtime-Trace-Id"
+)
+
+const apiPrefix = "/2018-06-01/runtime/"
+
+// ErrClosed is returned when using a closed Server.
+var ErrClosed = errors.New("runtimeapi: server closed")
+
+// Error is an error reported by the function, or by the emulator on timeouts and crashes.
+type Error struct {
+	Message    string            `json:"errorMessage"`
+	Type       string            `json:"errorType"`
+	StackTrace []json.RawMessage `json:"stackTrace,omitempty"`
+}
+
+// Error returns the error message, prefixed by its type.
+func (e *Error) Error() string {
+	return e.Type + ": " + e.Message
+}
+
+// Result is the result of an invocation.
+type Result struct {
+	// RequestID is the AWS request id of the invocation.
+	RequestID string
+
+	// Payload is the response payload. It is nil if the invocation failed.
+	Payload []byte
+
+	// Error is the invocation error, or nil if the invocation succeeded.
+	Error *Error
+
+	// ColdStart is true if the invocation has been the first one handled by the function process.
+	ColdStart bool
+
+	// Duration is the time elapsed between the moment the function received the event and the result.
+	Duration time.Duration
+}
+
+// Decode decodes the JSON payload into v.
+func (r *Result) Decode(v interface{}) error {
+	if r.Error != nil {
+		return r.Error
+	}
+	return json.Unmarshal(r.Payload, v)
+}
+
+// Response decodes the payload as a lambada Response.
+func (r *Result) Response() (lambada.Response, error) {
+	var res lambada.Response
+	err := r.Decode(&res)
+	return res, err
+}
+
+// An Option configures a Server.
+type Option func(*Server)
+
+// WithTimeout sets the function timeout. The default is DefaultTimeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.timeout = timeout
+	}
+}
+
+// WithFunctionName sets the name of the emulated function. The default is DefaultFunctionName.
+func WithFunctionName(name string) Option {
+	return func(s *Server) {
+		s.functionName = name
+	}
+}
+
+// WithEnv adds environment variables, in the key=value form, to the processes started by Server.Start.
+func WithEnv(env ...string) Option {
+	return func(s *Server) {
+		s.env = append(s.env, env...)
+	}
+}
+
+// WithOutput copies the output (stdout and stderr) of the processes started by Server.Start to w.
+// The output is always available through Server.Logs.
+func WithOutput(w io.Writer) Option {
+	return func(s *Server) {
+		s.output = w
+	}
+}
+
+// Server is a Lambda Runtime API emulator.
+type Server struct {
+	listener     net.Listener
+	server       *http.Server
+	timeout      time.Duration
+	functionName string
+	env          []string
+	output       io.Writer
+	logs         lockedBuffer
+	queue        chan *invocation
+	closed       chan struct{}
+	closeOnce    sync.Once
+
+	mu        sync.Mutex
+	running   map[string]*invocation
+	coldStart bool
+	initError *Error
+	command   []string
+	proc      *process
+}
+
+// NewServer starts a new Runtime API emulator, listening on a random port of the loopback interface.
+func NewServer(options ...Option) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener:     listener,
+		timeout:      DefaultTimeout,
+		functionName: DefaultFunctionName,
+		queue:        make(chan *invocation),
+		closed:       make(chan struct{}),
+		running:      map[string]*invocation{},
+		coldStart:    true,
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+
+	s.server = &http.Server{Handler: http.HandlerFunc(s.serveAPI)}
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// Addr returns the address of the emulator, which is the value of the AWS_LAMBDA_RUNTIME_API environment variable.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Env returns the environment variables, in the key=value form, to set on a function process for it to connect to
+// the emulator. This includes AWS_LAMBDA_FUNCTION_NAME, which makes lambada.IsLambda return true.
+func (s *Server) Env() []string {
+	return []string{
+		"AWS_LAMBDA_RUNTIME_API=" + s.Addr(),
+		"AWS_LAMBDA_FUNCTION_NAME=" + s.functionName,
+		"AWS_LAMBDA_FUNCTION_VERSION=$LATEST",
+		"AWS_LAMBDA_FUNCTION_MEMORY_SIZE=128",
+		"AWS_LAMBDA_LOG_GROUP_NAME=/aws/lambda/" + s.functionName,
+		"AWS_REGION=us-east-1",
+		"AWS_DEFAULT_REGION=us-east-1",
+	}
+}
+
+// Start starts the function process by running the given command, with the environment of the current process
+// augmented by Env and WithEnv.
+// If the process exits or is killed following a timeout, a new one is started on the next invocation.
+func (s *Server) Start(name string, args ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.proc != nil {
+		return errors.New("runtimeapi: a process is already started")
+	}
+	s.command = append([]string{name}, args...)
+	return s.startLocked()
+}
+
+// startLocked starts a new process. s.mu must be held.
+func (s *Server) startLocked() error {
+	cmd := exec.Command(s.command[0], s.command[1:]...)
+	cmd.Env = append(append(os.Environ(), s.Env()...), s.env...)
+	var output io.Writer = &s.logs
+	if s.output != nil {
+		output = io.MultiWriter(&s.logs, s.output)
+	}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p := &process{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+	s.proc = p
+	s.coldStart = true
+	return nil
+}
+
+// process returns the current function process, starting a new one if the previous one has exited.
+// It returns nil if the server does not manage the function process.
+func (s *Server) process() (*process, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.proc == nil {
+		return nil, nil
+	}
+	if s.proc.exited() {
+		if err := s.startLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return s.proc, nil
+}
+
+// hasServed returns whether p has handled at least one invocation.
+func (s *Server) hasServed(p *process) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.proc == p && !s.coldStart
+}
+
+// Logs returns the output of the processes started by Start.
+// As the output is copied asynchronously, the most recent lines may not be available yet when an invocation returns.
+func (s *Server) Logs() string {
+	return s.logs.String()
+}
+
+// InitError returns the initialization error reported by the function, if any.
+// Note that the aws-lambda-go runtime never reports initialization errors, and exits instead.
+func (s *Server) InitError() *Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.initError
+}
+
+// Close stops the emulator and kills the function process, if any.
+func (s *Server) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+
+	s.mu.Lock()
+	p := s.proc
+	s.mu.Unlock()
+	if p != nil {
+		p.kill()
+	}
+	return s.server.Close()
+}
+
+// Invoke invokes the function with the given payload and waits for the result.
+// payload is sent as-is if it is a []byte or a json.RawMessage, and is marshalled to JSON otherwise (e.g. a
+// lambada.Request).
+//
+// Function errors, timeouts and crashes are reported in Result.Error. The returned error is only set if the invocation
+// could not be performed, for instance when ctx is done before the function handles the event.
+func (s *Server) Invoke(ctx context.Context, payload interface{}) (*Result, error) {
+	var data []byte
+	switch p := payload.(type) {
+	case []byte:
+		data = p
+	case json.RawMessage:
+		data = p
+	default:
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	inv := &invocation{
+		id:      newRequestID(),
+		traceID: newTraceID(),
+		payload: data,
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	// Wait for the function to take the invocation
+	var p *process
+	var exited <-chan struct{}
+	for queued := false; !queued; {
+		var err error
+		if p, err = s.process(); err != nil {
+			return nil, err
+		}
+		if p != nil {
+			exited = p.done
+		}
+
+		select {
+		case s.queue <- inv:
+			queued = true
+		case <-exited:
+			// The process may exit after an invocation (e.g. after a panic), in which case a new one is started.
+			// Otherwise, it has failed to initialize.
+			if !s.hasServed(p) {
+				return nil, fmt.Errorf("runtimeapi: process exited before handling the event: %v", p.err)
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.closed:
+			return nil, ErrClosed
+		}
+	}
+	<-inv.started
+
+	timer := time.NewTimer(time.Until(inv.deadline))
+	defer timer.Stop()
+
+	select {
+	case <-inv.done:
+	case <-timer.C:
+		s.complete(inv, nil, &Error{
+			Type:    ErrorTypeTimeout,
+			Message: fmt.Sprintf("Task timed out after %.2f seconds", s.timeout.Seconds()),
+		})
+		if p != nil {
+			p.kill()
+		}
+	case <-exited:
+		s.complete(inv, nil, &Error{
+			Type:    ErrorTypeExit,
+			Message: fmt.Sprintf("Runtime exited: %v", p.err),
+		})
+	case <-ctx.Done():
+		s.complete(inv, nil, nil)
+		return nil, ctx.Err()
+	case <-s.closed:
+		s.complete(inv, nil, nil)
+		return nil, ErrClosed
+	}
+	return inv.result, nil
+}
+
+// Handler returns a lambda.Handler invoking the function through the emulator.
+// This allows serving the function over HTTP using lambada.NewEmulator. Function errors are returned as errors.
+func (s *Server) Handler() lambda.Handler {
+	return handler{s}
+}
+
+type handler struct {
+	s *Server
+}
+
+func (h handler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	res, err := h.s.Invoke(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return res.Payload, nil
+}
+
+// serveAPI implements the Runtime API endpoints.
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, apiPrefix)
+	switch {
+	case path == r.URL.Path:
+		writeError(w, http.StatusNotFound, "InvalidPath", "Unknown path "+r.URL.Path)
+	case path == "invocation/next" && r.Method == http.MethodGet:
+		s.serveNext(w, r)
+	case path == "init/error" && r.Method == http.MethodPost:
+		s.mu.Lock()
+		s.initError = readError(r.Body)
+		s.mu.Unlock()
+		writeAccepted(w)
+	case strings.HasPrefix(path, "invocation/") && r.Method == http.MethodPost:
+		id, kind, _ := strings.Cut(strings.TrimPrefix(path, "invocation/"), "/")
+		s.serveResult(w, r, id, kind)
+	default:
+		writeError(w, http.StatusNotFound, "InvalidPath", "Unknown path "+r.URL.Path)
+	}
+}
+
+// serveNext serves the next invocation endpoint, which blocks until an event is available.
+func (s *Server) serveNext(w http.ResponseWriter, r *http.Request) {
+	var inv *invocation
+	select {
+	case inv = <-s.queue:
+	case <-r.Context().Done():
+		return
+	case <-s.closed:
+		writeError(w, http.StatusGone, "ServerClosed", "The server is closed")
+		return
+	}
+
+	s.mu.Lock()
+	inv.start = time.Now()
+	inv.deadline = inv.start.Add(s.timeout)
+	inv.coldStart = s.coldStart
+	s.coldStart = false
+	s.running[inv.id] = inv
+	s.mu.Unlock()
+	close(inv.started)
+
+	h := w.Header()
+	h.Set("Content-Type", "application/json")
+	h.Set(headerRequestID, inv.id)
+	h.Set(headerDeadline, strconv.FormatInt(inv.deadline.UnixNano()/int64(time.Millisecond), 10))
+	h.Set(headerFunctionARN, "arn:aws:lambda:us-east-1:123456789012:function:"+s.functionName)
+	h.Set(headerTraceID, inv.traceID)
+	w.Write(inv.payload)
+}
+
+// serveResult serves the invocation response and error endpoints.
+func (s *Server) serveResult(w http.ResponseWriter, r *http.Request, id, kind string) {
+	if kind != "response" && kind != "error" {
+		writeError(w, http.StatusNotFound, "InvalidPath", "Unknown path "+r.URL.Path)
+		return
+	}
+
+	s.mu.Lock()
+	inv := s.running[id]
+	s.mu.Unlock()
+	if inv == nil {
+		writeError(w, http.StatusBadRequest, "InvalidRequestID", "Unknown or completed request id "+id)
+		return
+	}
+
+	if kind == "error" {
+		s.complete(inv, nil, readError(r.Body))
+	} else {
+		payload, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidPayload", err.Error())
+			return
+		}
+		s.complete(inv, payload, nil)
+	}
+	writeAccepted(w)
+}
+
+// complete completes inv with the given result, unless it has already been completed.
+func (s *Server) complete(inv *invocation, payload []byte, invErr *Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.running[inv.id]; !ok {
+		return
+	}
+	delete(s.running, inv.id)
+	inv.result = &Result{
+		RequestID: inv.id,
+		Payload:   payload,
+		Error:     invErr,
+		ColdStart: inv.coldStart,
+		Duration:  time.Since(inv.start),
+	}
+	close(inv.done)
+}
+
+// invocation is a pending invocation.
+type invocation struct {
+	id        string
+	traceID   string
+	payload   []byte
+	started   chan struct{}
+	done      chan struct{}
+	start     time.Time
+	deadline  time.Time
+	coldStart bool
+	result    *Result
+}
+
+// process is a function process started by the server.
+type process struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+}
+
+func (p *process) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// kill kills the process and waits for it to exit.
+func (p *process) kill() {
+	p.cmd.Process.Kill()
+	<-p.done
+}
+
+// readError reads an error payload sent by the function.
+func readError(r io.Reader) *Error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return &Error{Type: "Runtime.InvalidError", Message: err.Error()}
+	}
+	var res Error
+	if err := json.Unmarshal(data, &res); err != nil {
+		return &Error{Type: "Runtime.InvalidError", Message: string(data)}
+	}
+	return &res
+}
+
+func writeAccepted(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"status":"OK"}`))
+}
+
+func writeError(w http.ResponseWriter, statusCode int, errorType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(Error{Type: errorType, Message: message})
+}
+
+// newRequestID returns a random UUID.
+func newRequestID() string {
+	s := randomHex(16)
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// newTraceID returns a random X-Ray trace header.
+func newTraceID() string {
+	return fmt.Sprintf("Root=1-%08x-%s;Parent=%s;Sampled=0", time.Now().Unix(), randomHex(12), randomHex(8))
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return strings.Repeat("0", 2*n)
+	}
+	return hex.EncodeToString(b)
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
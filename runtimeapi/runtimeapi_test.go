@@ -0,0 +1,187 @@
+package runtimeapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/rajarathnabalan/lambada"
+	"github.com/rajarathnabalan/lambada/lambadatest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// functionEnv is set when the test binary is started as a Lambda function
+const functionEnv = "RUNTIMEAPI_TEST_FUNCTION"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(functionEnv) != "" {
+		lambada.Serve(http.HandlerFunc(testFunction))
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// testFunction is the function served when the test binary is started by the emulator
+func testFunction(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/sleep":
+		time.Sleep(time.Minute)
+	case "/panic":
+		panic("boom")
+	case "/exit":
+		os.Exit(3)
+	case "/log":
+		log.Printf("log line from %s", lambada.GetRequest(r).RequestContext.RequestID)
+	}
+
+	lc, _ := lambdacontext.FromContext(r.Context())
+	deadline, _ := r.Context().Deadline()
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "%s %s %t", r.URL.Path, lc.AwsRequestID, time.Until(deadline) > 0)
+}
+
+func startServer(t *testing.T, options ...Option) *Server {
+	t.Helper()
+	srv, err := NewServer(append([]Option{WithEnv(functionEnv + "=1")}, options...)...)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	require.NoError(t, srv.Start(os.Args[0]))
+	return srv
+}
+
+func invoke(t *testing.T, srv *Server, path string) *Result {
+	t.Helper()
+	event, err := lambadatest.V2(http.MethodGet, path).Build()
+	require.NoError(t, err)
+	res, err := srv.Invoke(context.Background(), event)
+	require.NoError(t, err)
+	return res
+}
+
+func TestInvoke(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := startServer(t)
+
+	res := invoke(t, srv, "/hello")
+	require.Nil(res.Error)
+	assert.True(res.ColdStart)
+	assert.NotEmpty(res.RequestID)
+
+	response, err := res.Response()
+	require.NoError(err)
+	assert.Equal(http.StatusOK, response.StatusCode)
+	assert.Equal("/hello "+res.RequestID+" true", response.Body)
+
+	res = invoke(t, srv, "/hello")
+	require.Nil(res.Error)
+	assert.False(res.ColdStart)
+}
+
+func TestInvokeErrors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := startServer(t, WithTimeout(500*time.Millisecond))
+
+	res := invoke(t, srv, "/sleep")
+	require.NotNil(res.Error)
+	assert.Equal(ErrorTypeTimeout, res.Error.Type)
+	assert.Equal("Task timed out after 0.50 seconds", res.Error.Message)
+
+	// A new process is started after a timeout
+	res = invoke(t, srv, "/hello")
+	require.Nil(res.Error)
+	assert.True(res.ColdStart)
+
+	res = invoke(t, srv, "/panic")
+	require.NotNil(res.Error)
+	assert.Equal("boom", res.Error.Message)
+	_, err := res.Response()
+	assert.Equal(res.Error, err)
+
+	// The process exits after a panic
+	res = invoke(t, srv, "/hello")
+	require.Nil(res.Error)
+	assert.True(res.ColdStart)
+
+	res = invoke(t, srv, "/exit")
+	require.NotNil(res.Error)
+	assert.Equal(ErrorTypeExit, res.Error.Type)
+	assert.Contains(res.Error.Message, "exit status 3")
+}
+
+func TestLogs(t *testing.T) {
+	srv := startServer(t)
+
+	res := invoke(t, srv, "/log")
+	require.Nil(t, res.Error)
+	assert.Eventually(t, func() bool {
+		return strings.Contains(srv.Logs(), "log line from ")
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestHandler(t *testing.T) {
+	srv := startServer(t)
+
+	ts := httptest.NewServer(lambada.NewEmulator(srv.Handler(), lambada.EventFormatV1))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/hello")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.True(t, strings.HasPrefix(string(body), "/hello "))
+}
+
+func TestExternalProcess(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv, err := NewServer()
+	require.NoError(err)
+	defer srv.Close()
+
+	// Play the function side of the Runtime API
+	go func() {
+		res, err := http.Get("http://" + srv.Addr() + "/2018-06-01/runtime/invocation/next")
+		if err != nil {
+			return
+		}
+		payload, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		id := res.Header.Get(headerRequestID)
+		http.Post("http://"+srv.Addr()+"/2018-06-01/runtime/invocation/"+id+"/response", "application/json",
+			strings.NewReader(`{"echo":`+string(payload)+`}`))
+	}()
+
+	res, err := srv.Invoke(context.Background(), map[string]int{"a": 1})
+	require.NoError(err)
+	require.Nil(res.Error)
+	assert.JSONEq(`{"echo":{"a":1}}`, string(res.Payload))
+	assert.True(res.ColdStart)
+
+	// Unknown request id
+	post, err := http.Post("http://"+srv.Addr()+"/2018-06-01/runtime/invocation/unknown/response", "application/json",
+		strings.NewReader("{}"))
+	require.NoError(err)
+	post.Body.Close()
+	assert.Equal(http.StatusBadRequest, post.StatusCode)
+
+	// No function is connected
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = srv.Invoke(ctx, []byte("{}"))
+	assert.ErrorIs(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,162 @@
+package lambada
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/morelj/httptools/header"
+)
+
+// TrailerMode represents the way the response trailers are delivered, as API Gateway has no concept of trailers.
+//
+// Trailers are collected the same way as net/http does: either declared using the Trailer header before the call
+// to WriteHeader and set afterwards, or set at any time using keys prefixed with http.TrailerPrefix.
+type TrailerMode int8
+
+const (
+	// Trailers are merged into the response headers.
+	//
+	// This is the default mode.
+	MergeTrailers TrailerMode = 0
+
+	// Trailers are dropped. A warning is logged through the response logger when a response has trailers.
+	DropTrailers TrailerMode = 1
+
+	// Trailers are encoded into the response body, after the content written by the handler, using the
+	// TrailerEncoder set with WithTrailerEncoder.
+	// If the response cannot have a body (e.g. 204 No Content), the trailers are merged into the headers.
+	// Responses without trailers are left untouched.
+	BodyTrailers TrailerMode = 2
+)
+
+// A TrailerEncoder encodes trailers into a response body, for protocols defining in-body trailers such as gRPC-Web.
+type TrailerEncoder interface {
+	// EncodeTrailers writes the encoded trailers to w, which appends them to the response body.
+	EncodeTrailers(w io.Writer, trailers http.Header) error
+}
+
+// GRPCWebTrailerEncoder is a TrailerEncoder which encodes trailers as a gRPC-Web trailer frame.
+type GRPCWebTrailerEncoder struct{}
+
+// EncodeTrailers writes the trailer frame to w.
+// The frame is made of the 0x80 flag byte, followed by the 4-byte big endian length of the payload, followed by the
+// payload, made of the trailers formatted as HTTP/1 headers with lower-cased keys.
+func (e GRPCWebTrailerEncoder) EncodeTrailers(w io.Writer, trailers http.Header) error {
+	keys := make([]string, 0, len(trailers))
+	for k := range trailers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var payload strings.Builder
+	for _, k := range keys {
+		for _, v := range trailers[k] {
+			payload.WriteString(strings.ToLower(k))
+			payload.WriteString(": ")
+			payload.WriteString(v)
+			payload.WriteString("\r\n")
+		}
+	}
+
+	frameHeader := make([]byte, 5)
+	frameHeader[0] = 0x80
+	binary.BigEndian.PutUint32(frameHeader[1:], uint32(payload.Len()))
+	if _, err := w.Write(frameHeader); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, payload.String())
+	return err
+}
+
+// WithTrailerMode sets the way response trailers are delivered.
+// See TrailerMode for details.
+func WithTrailerMode(mode TrailerMode) Option {
+	return func(o *options) {
+		o.trailerMode = mode
+	}
+}
+
+// WithTrailerEncoder sets the encoder used to write the trailers into the response body, and sets the trailer mode
+// to BodyTrailers.
+func WithTrailerEncoder(encoder TrailerEncoder) Option {
+	return func(o *options) {
+		o.trailerMode = BodyTrailers
+		o.trailerEncoder = encoder
+	}
+}
+
+// collectTrailers returns the trailers set by the handler, or nil if there are none.
+func (w *ResponseWriter) collectTrailers() http.Header {
+	var trailers http.Header
+	add := func(k string, v []string) {
+		if len(v) == 0 {
+			return
+		}
+		if trailers == nil {
+			trailers = http.Header{}
+		}
+		trailers[http.CanonicalHeaderKey(k)] = append(trailers[http.CanonicalHeaderKey(k)], v...)
+	}
+
+	// Declared trailers
+	for _, declared := range w.lockedHeader.Values(header.Trailer) {
+		for _, k := range strings.Split(declared, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				add(k, w.header.Values(k))
+			}
+		}
+	}
+
+	// Trailers using the TrailerPrefix
+	for k, v := range w.header {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			add(strings.TrimPrefix(k, http.TrailerPrefix), v)
+		}
+	}
+
+	return trailers
+}
+
+// deliverTrailers collects the trailers and delivers them according to the trailer mode.
+func (w *ResponseWriter) deliverTrailers() {
+	w.trailers = w.collectTrailers()
+
+	// The Trailer header is meaningless without actual trailers
+	delete(w.lockedHeader, header.Trailer)
+	for k := range w.lockedHeader {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			delete(w.lockedHeader, k)
+		}
+	}
+
+	mode := w.trailerMode
+	if mode == BodyTrailers && (w.trailerEncoder == nil || !bodyAllowedForStatus(w.statusCode)) {
+		mode = MergeTrailers
+	}
+
+	if mode == BodyTrailers {
+		if len(w.trailers) == 0 {
+			return
+		}
+		if err := w.trailerEncoder.EncodeTrailers(&w.body, w.trailers); err == nil {
+			return
+		}
+		// Fallback to merging if the trailers cannot be encoded
+		mode = MergeTrailers
+	}
+
+	if mode == MergeTrailers {
+		for k, v := range w.trailers {
+			w.lockedHeader[k] = v
+		}
+	}
+}
+
+// Trailer returns the trailers set by the handler.
+// The trailers are only known once the response has been finalized, that is after the http.Handler has returned.
+func (w *ResponseWriter) Trailer() http.Header {
+	return w.trailers
+}
@@ -0,0 +1,81 @@
+package lambada
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeWithTrailers(w *ResponseWriter) {
+	w.Header().Set("Trailer", "X-Checksum")
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("Hello, World!"))
+	w.Header().Set("X-Checksum", "abc")
+	w.Header().Set(http.TrailerPrefix+"X-Other", "def")
+	w.Header().Set("X-Ignored", "ignored")
+}
+
+func TestResponseWriterMergeTrailers(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newResponseWriter(AutoContentType, false)
+	writeWithTrailers(w)
+	w.finalize()
+
+	assert.Equal(http.Header{"X-Checksum": {"abc"}, "X-Other": {"def"}}, w.Trailer())
+	assert.Equal("abc", w.lockedHeader.Get("X-Checksum"))
+	assert.Equal("def", w.lockedHeader.Get("X-Other"))
+	assert.Equal("", w.lockedHeader.Get("X-Ignored"))
+	assert.Equal("", w.lockedHeader.Get("Trailer"))
+	assert.Equal("Hello, World!", string(w.Body()))
+}
+
+func TestResponseWriterDropTrailers(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newResponseWriter(AutoContentType, false)
+	w.trailerMode = DropTrailers
+	writeWithTrailers(w)
+	w.finalize()
+
+	assert.Len(w.Trailer(), 2)
+	assert.Equal("", w.lockedHeader.Get("X-Checksum"))
+	assert.Equal("", w.lockedHeader.Get("Trailer"))
+}
+
+func TestResponseWriterBodyTrailers(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newResponseWriter(AutoContentType, false)
+	w.trailerMode = BodyTrailers
+	w.trailerEncoder = GRPCWebTrailerEncoder{}
+	writeWithTrailers(w)
+	w.finalize()
+
+	payload := "x-checksum: abc\r\nx-other: def\r\n"
+	expected := bytes.NewBufferString("Hello, World!")
+	expected.Write([]byte{0x80, 0, 0, 0, byte(len(payload))})
+	expected.WriteString(payload)
+
+	assert.Equal(expected.Bytes(), w.Body())
+	assert.Equal("", w.lockedHeader.Get("X-Checksum"))
+	assert.Equal(strconv.Itoa(expected.Len()), w.lockedHeader.Get("Content-Length"))
+}
+
+func TestResponseWriterBodyTrailersWithoutTrailers(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newResponseWriter(AutoContentType, false)
+	w.trailerMode = BodyTrailers
+	w.trailerEncoder = GRPCWebTrailerEncoder{}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"hello":"world"}`))
+	w.finalize()
+
+	assert.Nil(w.Trailer())
+	assert.Equal(`{"hello":"world"}`, string(w.Body()))
+	assert.Equal("17", w.lockedHeader.Get("Content-Length"))
+}
@@ -7,9 +7,10 @@ import (
 	"net/url"
 )
 
-// makeV1Request converts the API Gateway V1 request stored into req into an http.Request
-func makeV1Request(ctx context.Context, req *Request) (*http.Request, error) {
-	body, err := bodyToBytes(req.Body, req.IsBase64Encoded)
+// makeV1Request converts the API Gateway V1 request stored into req into an http.Request.
+// The body is decoded using bodyDecoder, which may be nil.
+func makeV1Request(ctx context.Context, req *Request, bodyDecoder *requestBodyDecoder) (*http.Request, error) {
+	body, err := bodyDecoder.bodyToBytes(req)
 	if err != nil {
 		return nil, err
 	}
@@ -23,9 +24,14 @@ func makeV1Request(ctx context.Context, req *Request) (*http.Request, error) {
 	// Update the request
 	httpReq.URL.Path = req.Path
 
-	if len(req.MultiValueQueryStringParameters) == 0 && len(req.QueryStringParameters) > 0 {
-		httpReq.URL.RawQuery = toURLValues(req.QueryStringParameters).Encode()
-	} else {
+	// API Gateway decodes the query parameters, whereas ALB does not
+	alb := req.RequestContext.ELB != nil
+	switch {
+	case len(req.MultiValueQueryStringParameters) == 0 && len(req.QueryStringParameters) > 0:
+		httpReq.URL.RawQuery = toURLValues(req.QueryStringParameters, alb).Encode()
+	case alb:
+		httpReq.URL.RawQuery = unescapeURLValues(req.MultiValueQueryStringParameters).Encode()
+	default:
 		httpReq.URL.RawQuery = url.Values(req.MultiValueQueryStringParameters).Encode()
 	}
 
@@ -0,0 +1,122 @@
+package lambada
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeV1Request(t *testing.T) {
+	cases := []struct {
+		req      Request
+		method   string
+		path     string
+		query    string
+		header   http.Header
+		host     string
+		remote   string
+		body     string
+		protocol string
+	}{
+		{
+			req: Request{
+				HTTPMethod:                      http.MethodPost,
+				Path:                            "/items",
+				MultiValueHeaders:               map[string][]string{"x-multi": {"1", "2"}, "host": {"example.com"}},
+				MultiValueQueryStringParameters: map[string][]string{"a": {"1", "2"}},
+				Body:                            "SGVsbG8=",
+				IsBase64Encoded:                 true,
+				RequestContext: RequestContext{
+					Protocol: "HTTP/1.1",
+				},
+			},
+			method:   http.MethodPost,
+			path:     "/items",
+			query:    "a=1&a=2",
+			header:   http.Header{"X-Multi": {"1", "2"}, "Host": {"example.com"}},
+			host:     "example.com",
+			body:     "Hello",
+			protocol: "HTTP/1.1",
+		},
+		{
+			req: Request{
+				HTTPMethod:            http.MethodGet,
+				Path:                  "/",
+				Headers:               map[string]string{"x-forwarded-for": "10.0.0.1", "x-forwarded-proto": "HTTP/1.0"},
+				QueryStringParameters: map[string]string{"b": "x y", "c": "100%"},
+				RequestContext: RequestContext{
+					DomainName: "api.example.com",
+				},
+			},
+			method:   http.MethodGet,
+			path:     "/",
+			query:    "b=x+y&c=100%25",
+			header:   http.Header{"X-Forwarded-For": {"10.0.0.1"}, "X-Forwarded-Proto": {"HTTP/1.0"}},
+			host:     "api.example.com",
+			remote:   "10.0.0.1",
+			protocol: "HTTP/1.0",
+		},
+		{
+			// ALB does not decode the query parameters
+			req: Request{
+				HTTPMethod:            http.MethodGet,
+				Path:                  "/",
+				Headers:               map[string]string{"host": "alb.example.com"},
+				QueryStringParameters: map[string]string{"na%20me": "x%20y", "c": "100%"},
+				RequestContext:        RequestContext{ELB: &events.ELBContext{}},
+			},
+			method: http.MethodGet,
+			path:   "/",
+			query:  "c=100%25&na+me=x+y",
+			header: http.Header{"Host": {"alb.example.com"}},
+			host:   "alb.example.com",
+		},
+		{
+			req: Request{
+				HTTPMethod:                      http.MethodGet,
+				Path:                            "/",
+				MultiValueHeaders:               map[string][]string{"host": {"alb.example.com"}},
+				MultiValueQueryStringParameters: map[string][]string{"na%20me": {"x%20y", "a+b"}},
+				RequestContext:                  RequestContext{ELB: &events.ELBContext{}},
+			},
+			method: http.MethodGet,
+			path:   "/",
+			query:  "na+me=x+y&na+me=a+b",
+			header: http.Header{"Host": {"alb.example.com"}},
+			host:   "alb.example.com",
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			r, err := makeV1Request(context.Background(), &c.req, nil)
+			require.NoError(err)
+			assert.Equal(c.method, r.Method)
+			assert.Equal(c.path, r.URL.Path)
+			assert.Equal(c.query, r.URL.RawQuery)
+			assert.Equal(c.header, r.Header)
+			assert.Equal(c.host, r.Host)
+			assert.Equal(c.remote, r.RemoteAddr)
+			assert.Equal(c.protocol, r.Proto)
+			assert.Same(&c.req, GetRequest(r))
+
+			body, err := io.ReadAll(r.Body)
+			require.NoError(err)
+			assert.Equal(c.body, string(body))
+		})
+	}
+}
+
+func TestMakeV1RequestInvalidBody(t *testing.T) {
+	_, err := makeV1Request(context.Background(), &Request{HTTPMethod: http.MethodGet, Body: "invalid", IsBase64Encoded: true}, nil)
+	assert.Error(t, err)
+}
@@ -22,7 +22,12 @@ func makeV2Request(ctx context.Context, req *Request) (*http.Request, error) {
 
 	// Update the request
 	httpReq.URL.Path = req.RawPath
-	httpReq.URL.RawQuery = toURLValues(req.QueryStringParameters).Encode()
+	if req.RawQueryString != "" {
+		httpReq.URL.RawQuery = req.RawQueryString
+	} else {
+		// The query parameters are already decoded
+		httpReq.URL.RawQuery = toURLValues(req.QueryStringParameters, false).Encode()
+	}
 	httpReq.Header = fromSingleValueHeaders(req.Headers)
 	httpReq.Host = req.RequestContext.DomainName
 	httpReq.RemoteAddr = req.RequestContext.HTTP.SourceIP
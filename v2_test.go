@@ -0,0 +1,58 @@
+package lambada
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeV2Request(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	req := Request{
+		Version:               "2.0",
+		RawPath:               "/prod/items",
+		Headers:               map[string]string{"x-test": "value", "content-type": "text/plain"},
+		RawQueryString:        "a=1&b=x%20y&c=100%25&b=2",
+		QueryStringParameters: map[string]string{"a": "1", "b": "x y,2", "c": "100%"},
+		Cookies:               []string{"c1=v1", "c2=v2", "invalid"},
+		Body:                  "Hello",
+	}
+	req.RequestContext.DomainName = "example.com"
+	req.RequestContext.HTTP.Method = http.MethodPut
+	req.RequestContext.HTTP.SourceIP = "10.0.0.1"
+	req.RequestContext.HTTP.Protocol = "HTTP/1.1"
+
+	r, err := makeV2Request(context.Background(), &req)
+	require.NoError(err)
+	assert.Equal(http.MethodPut, r.Method)
+	assert.Equal("/prod/items", r.URL.Path)
+	assert.Equal("a=1&b=x%20y&c=100%25&b=2", r.URL.RawQuery)
+	assert.Equal([]string{"x y", "2"}, r.URL.Query()["b"])
+	assert.Equal("value", r.Header.Get("X-Test"))
+	assert.Equal("example.com", r.Host)
+	assert.Equal("10.0.0.1", r.RemoteAddr)
+	assert.Equal(1, r.ProtoMajor)
+	assert.Equal(1, r.ProtoMinor)
+	assert.Len(r.Cookies(), 2)
+	assert.Same(&req, GetRequest(r))
+
+	body, err := io.ReadAll(r.Body)
+	require.NoError(err)
+	assert.Equal("Hello", string(body))
+}
+
+func TestMakeV2RequestWithoutRawQueryString(t *testing.T) {
+	// The query parameters are already decoded
+	req := Request{Version: "2.0", RawPath: "/", QueryStringParameters: map[string]string{"q": "100% a+b"}}
+	req.RequestContext.HTTP.Method = http.MethodGet
+
+	r, err := makeV2Request(context.Background(), &req)
+	require.NoError(t, err)
+	assert.Equal(t, "100% a+b", r.URL.Query().Get("q"))
+}
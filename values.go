@@ -4,15 +4,37 @@ import (
 	"net/url"
 )
 
-// toURLValues converts a simple map into an url.Values
-func toURLValues(v map[string]string) url.Values {
+// toURLValues converts a simple map into an url.Values.
+// If unescape is true, keys and values are URL-decoded (see unescapeQuery).
+func toURLValues(v map[string]string, unescape bool) url.Values {
 	res := make(url.Values)
 	for k, v := range v {
-		newV, err := url.QueryUnescape(v)
-		if err == nil {
-			v = newV
+		if unescape {
+			k, v = unescapeQuery(k), unescapeQuery(v)
 		}
-		res.Set(k, v)
+		res.Add(k, v)
 	}
 	return res
 }
+
+// unescapeURLValues returns a copy of v with URL-decoded keys and values (see unescapeQuery).
+func unescapeURLValues(v map[string][]string) url.Values {
+	res := make(url.Values)
+	for k, values := range v {
+		k = unescapeQuery(k)
+		for _, value := range values {
+			res.Add(k, unescapeQuery(value))
+		}
+	}
+	return res
+}
+
+// unescapeQuery URL-decodes s, which is kept as-is if it contains invalid escapes.
+// This is needed for ALB events, whose query parameters are passed as sent by the client, whereas API Gateway decodes
+// them.
+func unescapeQuery(s string) string {
+	if unescaped, err := url.QueryUnescape(s); err == nil {
+		return unescaped
+	}
+	return s
+}
@@ -0,0 +1,209 @@
+package lambada
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// TraceHeader is the name of the header holding the X-Ray trace context.
+const TraceHeader = "X-Amzn-Trace-Id"
+
+// TraceparentHeader is the name of the W3C Trace Context header.
+const TraceparentHeader = "Traceparent"
+
+// lambdaTraceKey is the context key used by aws-lambda-go to store the trace header of the invocation.
+const lambdaTraceKey = "x-amzn-trace-id"
+
+// ErrInvalidTraceHeader is returned when parsing an invalid X-Ray trace header.
+var ErrInvalidTraceHeader = errors.New("invalid trace header")
+
+// TraceContext is a parsed X-Ray trace header, such as:
+//
+//	Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1;Lineage=a87bd80c:1
+type TraceContext struct {
+	// Root is the trace id (e.g. 1-5759e988-bd862e3fe1be46a994272793).
+	Root string
+
+	// Parent is the id of the parent segment (e.g. 53995c3f42cd8ad8).
+	Parent string
+
+	// Sampled is the sampling decision: 1 (sampled), 0 (not sampled), ? (to be decided) or empty.
+	Sampled string
+
+	// Lineage is the lineage of the trace, used by AWS to detect loops.
+	Lineage string
+
+	// Extra holds the other key=value fields of the header, in order.
+	Extra []string
+}
+
+// ParseTraceHeader parses the value of an X-Ray trace header. The Root field is mandatory.
+func ParseTraceHeader(value string) (TraceContext, error) {
+	var res TraceContext
+	for _, field := range strings.Split(value, ";") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			return TraceContext{}, ErrInvalidTraceHeader
+		}
+		switch k {
+		case "Root":
+			res.Root = v
+		case "Parent":
+			res.Parent = v
+		case "Sampled":
+			res.Sampled = v
+		case "Lineage":
+			res.Lineage = v
+		default:
+			res.Extra = append(res.Extra, field)
+		}
+	}
+	if res.Root == "" {
+		return TraceContext{}, ErrInvalidTraceHeader
+	}
+	return res, nil
+}
+
+// String formats t as an X-Ray trace header.
+func (t TraceContext) String() string {
+	fields := []string{"Root=" + t.Root}
+	if t.Parent != "" {
+		fields = append(fields, "Parent="+t.Parent)
+	}
+	if t.Sampled != "" {
+		fields = append(fields, "Sampled="+t.Sampled)
+	}
+	if t.Lineage != "" {
+		fields = append(fields, "Lineage="+t.Lineage)
+	}
+	return strings.Join(append(fields, t.Extra...), ";")
+}
+
+// IsSampled returns whether the trace is sampled.
+func (t TraceContext) IsSampled() bool {
+	return t.Sampled == "1"
+}
+
+// Traceparent converts t to a W3C Trace Context traceparent header value, such as:
+//
+//	00-5759e988bd862e3fe1be46a994272793-53995c3f42cd8ad8-01
+//
+// The X-Ray trace id is made of the epoch and random parts of Root. An empty string is returned if Root or Parent
+// is not valid.
+func (t TraceContext) Traceparent() string {
+	parts := strings.Split(t.Root, "-")
+	if len(parts) != 3 || parts[0] != "1" || len(parts[1]) != 8 || len(parts[2]) != 24 || len(t.Parent) != 16 {
+		return ""
+	}
+	traceID := strings.ToLower(parts[1] + parts[2])
+	parent := strings.ToLower(t.Parent)
+	if !isHex(traceID) || !isHex(parent) {
+		return ""
+	}
+
+	flags := "00"
+	if t.IsSampled() {
+		flags = "01"
+	}
+	return "00-" + traceID + "-" + parent + "-" + flags
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+type traceContextKeyType struct{}
+
+var traceContextKey = traceContextKeyType{}
+
+// WithTraceContext returns a new context.Context with the given TraceContext attached.
+func WithTraceContext(ctx context.Context, t TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey, t)
+}
+
+// TraceContextFromContext returns the TraceContext attached to ctx.
+// Lambada attaches the trace context of every invocation to the context of the http.Request. It is taken from the
+// Lambda invocation, or from the X-Amzn-Trace-Id request header.
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	t, ok := ctx.Value(traceContextKey).(TraceContext)
+	return t, ok
+}
+
+// GetTraceContext returns the TraceContext of r. See TraceContextFromContext.
+func GetTraceContext(r *http.Request) (TraceContext, bool) {
+	return TraceContextFromContext(r.Context())
+}
+
+// attachTraceContext attaches the trace context of the invocation to r, if any.
+// The trace header provided by Lambda is preferred over the one forwarded by API Gateway, as its parent is the
+// function segment.
+func attachTraceContext(ctx context.Context, r *http.Request) *http.Request {
+	value, _ := ctx.Value(lambdaTraceKey).(string)
+	if value == "" {
+		value = r.Header.Get(TraceHeader)
+	}
+	if value == "" {
+		return r
+	}
+	t, err := ParseTraceHeader(value)
+	if err != nil {
+		return r
+	}
+	return r.WithContext(WithTraceContext(r.Context(), t))
+}
+
+// InjectTraceHeaders sets the X-Amzn-Trace-Id header of h using the TraceContext attached to ctx, if any. If
+// traceparent is true, the W3C traceparent header is also set.
+// Existing headers are left untouched. InjectTraceHeaders returns whether a TraceContext has been found.
+func InjectTraceHeaders(ctx context.Context, h http.Header, traceparent bool) bool {
+	t, ok := TraceContextFromContext(ctx)
+	if !ok {
+		return false
+	}
+	if h.Get(TraceHeader) == "" {
+		h.Set(TraceHeader, t.String())
+	}
+	if tp := t.Traceparent(); traceparent && tp != "" && h.Get(TraceparentHeader) == "" {
+		h.Set(TraceparentHeader, tp)
+	}
+	return true
+}
+
+// TraceTransport is an http.RoundTripper propagating the trace context of the outbound requests' context (see
+// InjectTraceHeaders). The contexts of the outbound requests must derive from the context of the incoming request:
+//
+//	client := &http.Client{Transport: &lambada.TraceTransport{Traceparent: true}}
+//	req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, "https://example.com", nil)
+//	res, err := client.Do(req)
+type TraceTransport struct {
+	// Base is the underlying RoundTripper. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	// Traceparent enables the propagation of the W3C traceparent header.
+	Traceparent bool
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *TraceTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if _, ok := TraceContextFromContext(r.Context()); ok {
+		// RoundTrippers must not modify the request
+		r = r.Clone(r.Context())
+		InjectTraceHeaders(r.Context(), r.Header, t.Traceparent)
+	}
+	return base.RoundTrip(r)
+}
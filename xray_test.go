@@ -0,0 +1,141 @@
+package lambada
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceHeader(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected TraceContext
+		err      bool
+	}{
+		{
+			value: "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1;Lineage=a87bd80c:1",
+			expected: TraceContext{
+				Root:    "1-5759e988-bd862e3fe1be46a994272793",
+				Parent:  "53995c3f42cd8ad8",
+				Sampled: "1",
+				Lineage: "a87bd80c:1",
+			},
+		},
+		{
+			value:    "Self=1-67891234-12456789abcdef012345678;Root=1-5759e988-bd862e3fe1be46a994272793; Sampled=?",
+			expected: TraceContext{Root: "1-5759e988-bd862e3fe1be46a994272793", Sampled: "?", Extra: []string{"Self=1-67891234-12456789abcdef012345678"}},
+		},
+		{value: "", err: true},
+		{value: "Parent=53995c3f42cd8ad8", err: true},
+		{value: "Root", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.value, func(t *testing.T) {
+			res, err := ParseTraceHeader(c.value)
+			if c.err {
+				assert.ErrorIs(t, err, ErrInvalidTraceHeader)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, res)
+		})
+	}
+}
+
+func TestTraceContextString(t *testing.T) {
+	value := "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1;Lineage=a87bd80c:1;Self=x"
+	tc, err := ParseTraceHeader(value)
+	require.NoError(t, err)
+	assert.Equal(t, value, tc.String())
+	assert.Equal(t, "Root=1-5759e988-bd862e3fe1be46a994272793", TraceContext{Root: "1-5759e988-bd862e3fe1be46a994272793"}.String())
+}
+
+func TestTraceparent(t *testing.T) {
+	cases := []struct {
+		tc       TraceContext
+		expected string
+	}{
+		{
+			tc:       TraceContext{Root: "1-5759e988-bd862e3fe1be46a994272793", Parent: "53995c3f42cd8ad8", Sampled: "1"},
+			expected: "00-5759e988bd862e3fe1be46a994272793-53995c3f42cd8ad8-01",
+		},
+		{
+			tc:       TraceContext{Root: "1-5759E988-BD862E3FE1BE46A994272793", Parent: "53995C3F42CD8AD8", Sampled: "?"},
+			expected: "00-5759e988bd862e3fe1be46a994272793-53995c3f42cd8ad8-00",
+		},
+		{tc: TraceContext{Root: "1-5759e988-bd862e3fe1be46a994272793"}},
+		{tc: TraceContext{Root: "2-5759e988-bd862e3fe1be46a994272793", Parent: "53995c3f42cd8ad8"}},
+		{tc: TraceContext{Root: "1-5759e988-bd862e3fe1be46a99427279z", Parent: "53995c3f42cd8ad8"}},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, c.tc.Traceparent(), c.tc.String())
+	}
+}
+
+func TestTraceContextPropagation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Outbound server
+	var outbound http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		outbound = r.Header
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: &TraceTransport{Traceparent: true}}
+
+	var tc TraceContext
+	var found bool
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tc, found = GetTraceContext(r)
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, srv.URL, nil)
+		res, err := client.Do(req)
+		if assert.NoError(err) {
+			res.Body.Close()
+		}
+	}))
+
+	apigwHeader := "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=1111111111111111;Sampled=1"
+	lambdaHeader := "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1;Lineage=a87bd80c:1"
+	req := Request{HTTPMethod: http.MethodGet, Path: "/", Headers: map[string]string{"X-Amzn-Trace-Id": apigwHeader}}
+
+	// The Lambda trace header takes precedence
+	_, err := h(context.WithValue(context.Background(), lambdaTraceKey, lambdaHeader), req)
+	require.NoError(err)
+	require.True(found)
+	assert.Equal("53995c3f42cd8ad8", tc.Parent)
+	assert.Equal(lambdaHeader, outbound.Get(TraceHeader))
+	assert.Equal("00-5759e988bd862e3fe1be46a994272793-53995c3f42cd8ad8-01", outbound.Get(TraceparentHeader))
+
+	// The request header is used otherwise
+	_, err = h(context.Background(), req)
+	require.NoError(err)
+	require.True(found)
+	assert.Equal("1111111111111111", tc.Parent)
+	assert.Equal(apigwHeader, outbound.Get(TraceHeader))
+
+	// No trace
+	_, err = h(context.Background(), Request{HTTPMethod: http.MethodGet, Path: "/"})
+	require.NoError(err)
+	assert.False(found)
+	assert.Empty(outbound.Get(TraceHeader))
+	assert.Empty(outbound.Get(TraceparentHeader))
+}
+
+func TestInjectTraceHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := WithTraceContext(context.Background(), TraceContext{Root: "1-5759e988-bd862e3fe1be46a994272793", Parent: "53995c3f42cd8ad8"})
+	h := http.Header{TraceHeader: {"existing"}}
+	assert.True(InjectTraceHeaders(ctx, h, false))
+	assert.Equal("existing", h.Get(TraceHeader))
+	assert.Empty(h.Get(TraceparentHeader))
+
+	assert.False(InjectTraceHeaders(context.Background(), http.Header{}, true))
+}